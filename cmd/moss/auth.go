@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// git_credentials returns the basic auth user and password each provider
+// expects a PAT to be sent as
+func git_credentials(repo *GitRepo) (string, string) {
+	switch repo.provider {
+	case "GITHUB", "GITEA":
+		return repo.pat, ""
+	case "GITLAB":
+		return "oauth2", repo.pat
+	case "BITBUCKET":
+		// bitbucket cloud's access token user, data center takes a bearer
+		// token instead, see git_auth_header
+		return "x-token-auth", repo.pat
+	case "AZURE_DEVOPS":
+		// azure ignores the user, the PAT goes in the password
+		return "moss", repo.pat
+	}
+	return "", ""
+}
+
+// git_auth_env returns the environment for a git command that talks to the
+// repo's remote. The PAT is handed to git as an http.extraHeader through
+// GIT_CONFIG_* variables, so it never shows up in process arguments, in
+// the clone's .git/config, or in the remote url git echoes back in errors.
+func git_auth_env(repo *GitRepo) []string {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if repo.pat == "" {
+		return env
+	}
+	header := git_auth_header(repo)
+	if header == "" {
+		return env
+	}
+	return append(env,
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: "+header,
+	)
+}
+
+// git_auth_header returns the Authorization header value git sends the PAT
+// as. Bitbucket Data Center HTTP access tokens are bearer tokens, every
+// other provider takes the PAT as basic auth.
+func git_auth_header(repo *GitRepo) string {
+	if repo.provider == "BITBUCKET" && repo.onprem {
+		return "Bearer " + repo.pat
+	}
+	user, pass := git_credentials(repo)
+	if user == "" && pass == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// run_git runs git with the repo's credentials, killing it if ctx is done.
+// Failures include git's stderr with any credentials scrubbed out.
+func run_git(ctx context.Context, repo *GitRepo, args ...string) error {
+	var errb bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	kill_on_cancel(cmd)
+	cmd.Env = git_auth_env(repo)
+	cmd.Stderr = &errb
+	if err := run_cmd(cmd); err != nil {
+		return scrub_error(fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(errb.String())), repo)
+	}
+	return nil
+}
+
+// scrub_secrets replaces every form of the repo's PAT in s
+func scrub_secrets(s string, repo *GitRepo) string {
+	if repo == nil || repo.pat == "" {
+		return s
+	}
+	user, pass := git_credentials(repo)
+	secrets := []string{
+		base64.StdEncoding.EncodeToString([]byte(user + ":" + pass)),
+		repo.pat,
+	}
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return s
+}
+
+// scrub_error returns err with the repo's PAT scrubbed from its message
+func scrub_error(err error, repo *GitRepo) error {
+	if err == nil {
+		return nil
+	}
+	scrubbed := scrub_secrets(err.Error(), repo)
+	if scrubbed == err.Error() {
+		return err
+	}
+	return errors.New(scrubbed)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitAuthEnv(t *testing.T) {
+	repo := &GitRepo{provider: "GITLAB", pat: "glpat-secret"}
+	env := git_auth_env(repo)
+	want := "GIT_CONFIG_VALUE_0=Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("oauth2:glpat-secret"))
+	if !contains(env, want) || !contains(env, "GIT_CONFIG_KEY_0=http.extraHeader") {
+		t.Errorf("auth header missing from env")
+	}
+	// repos without a PAT don't get a header
+	for _, e := range git_auth_env(&GitRepo{provider: "GIT"}) {
+		if strings.HasPrefix(e, "GIT_CONFIG_VALUE_0=Authorization") {
+			t.Errorf("unexpected auth header for a repo without a PAT")
+		}
+	}
+}
+
+func TestGitAuthEnvBitbucket(t *testing.T) {
+	// cloud access tokens go as basic auth with the x-token-auth user
+	cloud := &GitRepo{provider: "BITBUCKET", pat: "bb-secret"}
+	want := "GIT_CONFIG_VALUE_0=Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("x-token-auth:bb-secret"))
+	if !contains(git_auth_env(cloud), want) {
+		t.Errorf("bitbucket cloud should use basic auth")
+	}
+	// data center HTTP access tokens go as a bearer token
+	dc := bitbucket_server_to_git(bitbucketServerRepo{Slug: "repo"}, "bbdc-secret", OrgConfig{Name: "PROJ", Type: "onprem"})
+	if !contains(git_auth_env(dc), "GIT_CONFIG_VALUE_0=Authorization: Bearer bbdc-secret") {
+		t.Errorf("bitbucket data center should use a bearer token")
+	}
+	if strings.Contains(scrub_secrets("Bearer bbdc-secret", dc), "bbdc-secret") {
+		t.Errorf("bearer token wasn't scrubbed")
+	}
+	// the flag survives a checkpoint round trip
+	if !new_checkpoint_repo(dc).git_repo().onprem {
+		t.Errorf("onprem flag lost in the checkpoint")
+	}
+}
+
+func TestScrubError(t *testing.T) {
+	repo := &GitRepo{provider: "GITHUB", pat: "ghp_secret"}
+	basic := base64.StdEncoding.EncodeToString([]byte("ghp_secret:"))
+	err := scrub_error(fmt.Errorf("fatal: https://ghp_secret@github.com/org/repo %s", basic), repo)
+	if strings.Contains(err.Error(), "ghp_secret") || strings.Contains(err.Error(), basic) {
+		t.Errorf("PAT wasn't scrubbed: %s", err)
+	}
+	if scrub_error(nil, repo) != nil {
+		t.Errorf("nil errors should stay nil")
+	}
+}
+
+func TestCloneDoesNotPersistPat(t *testing.T) {
+	origin := gitRepoWithCommit(t)
+	dir := filepath.Join(t.TempDir(), "clone")
+	repo := &GitRepo{Name: "origin", CloneURL: origin, provider: "GITHUB", pat: "ghp_secret"}
+	if err := clone_repo(context.Background(), repo, dir); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+	git_config, err := os.ReadFile(filepath.Join(dir, ".git", "config"))
+	if err != nil {
+		t.Fatalf("failed to read the clone's config: %v", err)
+	}
+	if strings.Contains(string(git_config), "ghp_secret") {
+		t.Errorf("PAT was written to the clone's config")
+	}
+}
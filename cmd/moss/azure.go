@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const azure_cloud_url = "https://dev.azure.com"
+
+// 6.0 needs Azure DevOps Server 2020 or newer, older servers can set
+// api_version on the org (e.g. 5.0 for Server 2019)
+const azure_default_api_version = "6.0"
+
+type azureProject struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+}
+
+type azureProjectList struct {
+	Value []azureProject `json:"value"`
+}
+
+// Azure DevOps git repository, see {project}/_apis/git/repositories
+type azureRepo struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	RemoteURL  string `json:"remoteUrl"`
+	WebURL     string `json:"webUrl"`
+	IsDisabled bool   `json:"isDisabled"`
+	Size       int64  `json:"size"`
+	// DefaultBranch is unset until something is pushed
+	DefaultBranch string       `json:"defaultBranch"`
+	Project       azureProject `json:"project"`
+}
+
+type azureRepoList struct {
+	Value []azureRepo `json:"value"`
+}
+
+type azurePushList struct {
+	Value []struct {
+		Date time.Time `json:"date"`
+	} `json:"value"`
+}
+
+// Convert Azure DevOps to common Git Repo Struct
+func azure_to_git(repo azureRepo, pat string, org OrgConfig) *GitRepo {
+	clone_url := repo.RemoteURL
+	// cloud remote urls include the org as the user, drop it
+	if u, err := url.Parse(clone_url); err == nil {
+		u.User = nil
+		clone_url = u.String()
+	}
+	return &GitRepo{
+		Name:     repo.Name,
+		FullName: fmt.Sprintf("%s/%s", repo.Project.Name, repo.Name),
+		CloneURL: clone_url,
+		HTMLURL:  repo.WebURL,
+		Private:  repo.Project.Visibility != "public",
+		orgname:  org.Name,
+		Archived: repo.IsDisabled,
+		pat:      pat,
+		scanner:  org.Scanner,
+		provider: "AZURE_DEVOPS",
+	}
+}
+
+// azure_org_url returns the collection url for an org. Cloud orgs live
+// under dev.azure.com, Azure DevOps Server orgs use base_url which should
+// point at the collection (e.g. https://tfs.example.com/tfs/DefaultCollection)
+func azure_org_url(org OrgConfig) (string, error) {
+	if org.Type == "onprem" {
+		if org.BaseURL == "" {
+			return "", fmt.Errorf("Azure DevOps on-prem org '%s' requires base_url", org.Name)
+		}
+		return strings.TrimSuffix(org.BaseURL, "/"), nil
+	}
+	base := azure_cloud_url
+	if org.BaseURL != "" {
+		base = strings.TrimSuffix(org.BaseURL, "/")
+	}
+	return fmt.Sprintf("%s/%s", base, url.PathEscape(org.Name)), nil
+}
+
+// azure_api_version returns the REST api version to request for an org
+func azure_api_version(org OrgConfig) string {
+	if org.APIVersion != "" {
+		return org.APIVersion
+	}
+	return azure_default_api_version
+}
+
+// Azure DevOps takes a PAT as the password of basic auth with any user
+func azure_headers(pat string) map[string]string {
+	auth := base64.StdEncoding.EncodeToString([]byte(":" + pat))
+	return map[string]string{"Authorization": "Basic " + auth}
+}
+
+func get_azure_projects(ctx context.Context, org_url string, api_version string, pat string) ([]azureProject, error) {
+	projects := make([]azureProject, 0)
+	continuation := ""
+	for {
+		page_url := fmt.Sprintf("%s/_apis/projects?$top=100&api-version=%s", org_url, api_version)
+		if continuation != "" {
+			page_url = fmt.Sprintf("%s&continuationToken=%s", page_url, url.QueryEscape(continuation))
+		}
+		var page azureProjectList
+		resp, err := get_json(ctx, page_url, azure_headers(pat), &page)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, page.Value...)
+		continuation = resp.Header.Get("x-ms-continuationtoken")
+		if continuation == "" || len(page.Value) == 0 {
+			break
+		}
+	}
+	return projects, nil
+}
+
+// get_azure_last_push returns the date of the most recent push to a repo
+func get_azure_last_push(ctx context.Context, org_url string, api_version string, repo azureRepo, pat string) (time.Time, bool, error) {
+	push_url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pushes?$top=1&api-version=%s",
+		org_url, url.PathEscape(repo.Project.Name), url.PathEscape(repo.ID), api_version)
+	var pushes azurePushList
+	if _, err := get_json(ctx, push_url, azure_headers(pat), &pushes); err != nil {
+		return time.Time{}, false, err
+	}
+	if len(pushes.Value) == 0 {
+		return time.Time{}, false, nil
+	}
+	return pushes.Value[0].Date, true, nil
+}
+
+// get_azure_org_repos lists every git repository across all projects of an
+// Azure DevOps organization
+func get_azure_org_repos(ctx context.Context, org OrgConfig, pat string, daysago int, skipRepos []string) ([]*GitRepo, error) {
+	org_url, err := azure_org_url(org)
+	if err != nil {
+		return nil, err
+	}
+	api_version := azure_api_version(org)
+	projects, err := get_azure_projects(ctx, org_url, api_version, pat)
+	if err != nil {
+		return nil, err
+	}
+	time_ago := time.Now().AddDate(0, 0, (-1 * daysago))
+	repos := make([]*GitRepo, 0)
+	for _, project := range projects {
+		repos_url := fmt.Sprintf("%s/%s/_apis/git/repositories?api-version=%s", org_url, url.PathEscape(project.Name), api_version)
+		var project_repos azureRepoList
+		if _, err := get_json(ctx, repos_url, azure_headers(pat), &project_repos); err != nil {
+			log.Error().Err(err).Str("org", org.Name).Str("project", project.Name).Msg("failed to list repos in project, continuing")
+			continue
+		}
+		for _, repo := range project_repos.Value {
+			// the repo listing only carries the project's id and name
+			repo.Project.Visibility = project.Visibility
+			g_repo := azure_to_git(repo, pat, org)
+			if g_repo.Archived {
+				log.Debug().Str("repo", g_repo.FullName).Msg("skipping repo because it's disabled")
+				continue
+			}
+			if contains(skipRepos, g_repo.FullName) {
+				log.Debug().Str("repo", g_repo.FullName).Msg("skipping repo due to config")
+				continue
+			}
+			// size isn't reported by every server version, only a repo
+			// without a default branch has never been pushed to
+			if repo.Size == 0 && repo.DefaultBranch == "" {
+				log.Debug().Str("repo", g_repo.FullName).Msg("skipping repo because it's empty")
+				continue
+			}
+			if daysago > 0 {
+				pushed, ok, err := get_azure_last_push(ctx, org_url, api_version, repo, pat)
+				if err != nil {
+					log.Warn().Err(err).Str("repo", g_repo.FullName).Msg("failed to get last push, scanning anyway")
+				} else if !ok || pushed.Before(time_ago) {
+					continue
+				} else {
+					g_repo.PushedAt = pushed
+				}
+			}
+			repos = append(repos, g_repo)
+		}
+	}
+	return repos, nil
+}
+
+func get_all_azure_repos(ctx context.Context, orgs []OrgConfig, conf Conf) map[string]*GitRepo {
+	azure_repos := make(map[string]*GitRepo)
+	for _, org := range orgs {
+		pat := getPat("AZURE_DEVOPS", org)
+		if pat == "" {
+			continue
+		}
+		repos, err := get_azure_org_repos(ctx, org, pat, conf.AzureDevOpsConfig.DaysToScan, conf.SkipRepos)
+		if err != nil {
+			log.Error().Err(err).Str("org", org.Name).Msg("Failed to get repos from Azure DevOps. Continuing")
+			continue
+		}
+		log.Info().Str("org", org.Name).Str("type", org.Type).Int("repos", len(repos)).Msg("enumerated Azure DevOps repos")
+		for _, repo := range repos {
+			azure_repos[repo.HTMLURL] = repo
+		}
+	}
+	return azure_repos
+}
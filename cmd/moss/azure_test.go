@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAzureOrgRepos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "" || pass != "azure-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		repo := func(project string, name string, disabled bool) azureRepo {
+			return azureRepo{
+				ID:         name + "-id",
+				Name:       name,
+				RemoteURL:  "https://myorg@dev.azure.com/myorg/" + project + "/_git/" + name,
+				WebURL:     "https://dev.azure.com/myorg/" + project + "/_git/" + name,
+				IsDisabled: disabled,
+				Size:       1024,
+				// older servers don't report size
+				DefaultBranch: "refs/heads/main",
+				Project:       azureProject{Name: project},
+			}
+		}
+		// never pushed to, size is 0 and there's no default branch
+		empty := repo("beta", "empty", false)
+		empty.Size = 0
+		empty.DefaultBranch = ""
+		switch r.URL.Path {
+		case "/myorg/_apis/projects":
+			if r.URL.Query().Get("continuationToken") == "" {
+				w.Header().Set("x-ms-continuationtoken", "next")
+				json.NewEncoder(w).Encode(azureProjectList{Value: []azureProject{{Name: "alpha", Visibility: "private"}}})
+			} else {
+				json.NewEncoder(w).Encode(azureProjectList{Value: []azureProject{{Name: "beta", Visibility: "public"}}})
+			}
+		case "/myorg/alpha/_apis/git/repositories":
+			json.NewEncoder(w).Encode(azureRepoList{Value: []azureRepo{repo("alpha", "svc", false), repo("alpha", "old", false)}})
+		case "/myorg/beta/_apis/git/repositories":
+			json.NewEncoder(w).Encode(azureRepoList{Value: []azureRepo{repo("beta", "site", false), repo("beta", "disabled", true), repo("beta", "skipme", false), empty}})
+		case "/myorg/alpha/_apis/git/repositories/old-id/pushes":
+			json.NewEncoder(w).Encode(map[string]interface{}{"value": []map[string]time.Time{{"date": time.Now().AddDate(-1, 0, 0)}}})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"value": []map[string]time.Time{{"date": time.Now()}}})
+		}
+	}))
+	defer srv.Close()
+
+	org := OrgConfig{Name: "myorg", Type: "cloud", BaseURL: srv.URL}
+	repos, err := get_azure_org_repos(context.Background(), org, "azure-token", 30, []string{"beta/skipme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("wanted 2 repos, got %d", len(repos))
+	}
+	if repos[0].FullName != "alpha/svc" || !repos[0].Private {
+		t.Errorf("repo converted wrong: %+v", repos[0])
+	}
+	if repos[1].FullName != "beta/site" || repos[1].Private {
+		t.Errorf("repo converted wrong: %+v", repos[1])
+	}
+	if repos[0].CloneURL != "https://dev.azure.com/myorg/alpha/_git/svc" {
+		t.Errorf("clone url should not contain a user, got %s", repos[0].CloneURL)
+	}
+	if _, err := azure_org_url(OrgConfig{Name: "server", Type: "onprem"}); err == nil {
+		t.Errorf("onprem without base_url should error")
+	}
+}
+
+func TestAzureApiVersion(t *testing.T) {
+	versions := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions = append(versions, r.URL.Query().Get("api-version"))
+		switch r.URL.Path {
+		case "/_apis/projects":
+			json.NewEncoder(w).Encode(azureProjectList{Value: []azureProject{{Name: "alpha"}}})
+		default:
+			// Azure DevOps Server 2019 doesn't report repo sizes
+			json.NewEncoder(w).Encode(azureRepoList{Value: []azureRepo{{ID: "svc-id", Name: "svc", DefaultBranch: "refs/heads/main", Project: azureProject{Name: "alpha"}}}})
+		}
+	}))
+	defer srv.Close()
+
+	org := OrgConfig{Name: "server", Type: "onprem", BaseURL: srv.URL, APIVersion: "5.0"}
+	repos, err := get_azure_org_repos(context.Background(), org, "azure-token", 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 1 {
+		t.Errorf("repos without a size but with a default branch should be scanned, got %d repos", len(repos))
+	}
+	for _, v := range versions {
+		if v != "5.0" {
+			t.Errorf("wanted api-version 5.0, got %s", v)
+		}
+	}
+	if azure_api_version(OrgConfig{}) != "6.0" {
+		t.Errorf("api version should default to 6.0")
+	}
+}
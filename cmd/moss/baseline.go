@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	baseline_new      = "new"
+	baseline_existing = "existing"
+)
+
+// savedRepoResult is a repo result read back from MOSS' json output. Errors
+// are written as {}, so Err only tells whether the repo failed, not why.
+type savedRepoResult struct {
+	Repository string
+	Org        string
+	URL        string
+	Provider   string
+	IsPrivate  bool
+	Results    []GitleaksResult
+	Err        json.RawMessage
+	TimedOut   bool
+	Canceled   bool
+}
+
+// incomplete returns why the repo's findings can't be trusted to be all of
+// them, or "" if its scan finished
+func (r savedRepoResult) incomplete() string {
+	switch {
+	case r.TimedOut:
+		return "timed out"
+	case r.Canceled:
+		return "canceled"
+	case len(r.Err) > 0 && string(r.Err) != "null":
+		return "failed"
+	}
+	return ""
+}
+
+// load_json_output reads a previous json output, keyed by org
+func load_json_output(path string) (map[string][]savedRepoResult, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("%s isn't MOSS json output: %w", path, err)
+	}
+	orgs := make(map[string][]savedRepoResult)
+	for org, value := range raw {
+		// run wide sections like _unique_secrets aren't orgs
+		if strings.HasPrefix(org, "_") {
+			continue
+		}
+		var repos []savedRepoResult
+		if err := json.Unmarshal(value, &repos); err != nil {
+			return nil, fmt.Errorf("%s isn't MOSS json output: %w", path, err)
+		}
+		orgs[org] = repos
+	}
+	return orgs, nil
+}
+
+// load_baseline reads the fingerprints of every finding in a previous json
+// output
+func load_baseline(path string) (map[string]bool, error) {
+	orgs, err := load_json_output(path)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make(map[string]bool)
+	for _, repos := range orgs {
+		for _, repo := range repos {
+			for _, finding := range repo.Results {
+				fingerprints[finding.fingerprint(repo.URL)] = true
+			}
+		}
+	}
+	return fingerprints, nil
+}
+
+// setup_baseline loads the configured baseline, path overrides the config
+func (c *Conf) setup_baseline(path string) error {
+	if path != "" {
+		c.Baseline = path
+	}
+	if c.Baseline == "" {
+		return nil
+	}
+	switch strings.ToLower(c.BaselineMode) {
+	case "", "suppress", "mark":
+	default:
+		return fmt.Errorf("unknown baseline_mode %q, expected suppress or mark", c.BaselineMode)
+	}
+	fingerprints, err := load_baseline(c.Baseline)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("baseline", c.Baseline).Int("findings", len(fingerprints)).Msg("loaded baseline")
+	c.baseline = fingerprints
+	return nil
+}
+
+// applyBaseline drops findings that are already in the baseline, or marks
+// them as existing when baseline_mode is mark. Everything left is new.
+func (r *GitleaksRepoResult) applyBaseline(conf Conf) {
+	if conf.baseline == nil {
+		return
+	}
+	mark := strings.ToLower(conf.BaselineMode) == "mark"
+	kept := make([]GitleaksResult, 0)
+	for _, result := range r.Results {
+		result.BaselineState = baseline_new
+		if conf.baseline[result.fingerprint(r.URL)] {
+			if !mark {
+				continue
+			}
+			result.BaselineState = baseline_existing
+		}
+		kept = append(kept, result)
+	}
+	r.Results = kept
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBaseline writes the json output of results as a baseline file
+func writeBaseline(t *testing.T, results []GitleaksRepoResult) string {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, []byte(json_output(results, []string{"org"})), 0644); err != nil {
+		t.Fatalf("failed to write baseline: %v", err)
+	}
+	return path
+}
+
+func TestApplyBaseline(t *testing.T) {
+	old := getRepoResult()
+	// errors can't be read back from json, the baseline must still load
+	errored := GitleaksRepoResult{Repository: "broken", Org: "org", Err: errors.New("clone failed")}
+	path := writeBaseline(t, []GitleaksRepoResult{old, errored})
+
+	current := getRepoResult()
+	fresh := current.Results[0]
+	fresh.StartLine = 100
+	current.Results = append(current.Results, fresh)
+
+	conf := Conf{}
+	if err := conf.setup_baseline(path); err != nil {
+		t.Fatalf("failed to load baseline: %v", err)
+	}
+	suppressed := current
+	suppressed.applyBaseline(conf)
+	if len(suppressed.Results) != 1 || suppressed.Results[0].StartLine != 100 || suppressed.Results[0].BaselineState != baseline_new {
+		t.Errorf("only the new finding should be left, got %+v", suppressed.Results)
+	}
+
+	conf.BaselineMode = "mark"
+	marked := current
+	marked.applyBaseline(conf)
+	if len(marked.Results) != 2 || marked.Results[0].BaselineState != baseline_existing || marked.Results[1].BaselineState != baseline_new {
+		t.Fatalf("findings should be marked, got %+v", marked.Results)
+	}
+	if md := markdown_output([]GitleaksRepoResult{marked}, []string{"org"}); !strings.Contains(md, "somefolder/README.md (existing)|") {
+		t.Errorf("markdown should flag existing findings, got %s", md)
+	}
+	if sarif := sarif_output([]GitleaksRepoResult{marked}, []string{"org"}, nil, reportExtras{}); !strings.Contains(sarif, `"baselineState":"unchanged"`) || !strings.Contains(sarif, `"baselineState":"new"`) {
+		t.Errorf("sarif should carry baseline states, got %s", sarif)
+	}
+}
+
+func TestSetupBaselineErrors(t *testing.T) {
+	conf := Conf{Baseline: writeBaseline(t, nil), BaselineMode: "ignore"}
+	if err := conf.setup_baseline(""); err == nil {
+		t.Errorf("unknown baseline modes should fail")
+	}
+	conf = Conf{}
+	if err := conf.setup_baseline(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("a missing baseline should fail")
+	}
+	conf = Conf{}
+	if err := conf.setup_baseline(""); err != nil || conf.baseline != nil {
+		t.Errorf("no baseline should be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const bitbucket_cloud_api = "https://api.bitbucket.org/2.0"
+
+type bitbucketLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+// Bitbucket Cloud repository, see /2.0/repositories/{workspace}
+type bitbucketCloudRepo struct {
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	FullName  string    `json:"full_name"`
+	IsPrivate bool      `json:"is_private"`
+	UpdatedOn time.Time `json:"updated_on"`
+	Links     struct {
+		HTML  bitbucketLink   `json:"html"`
+		Clone []bitbucketLink `json:"clone"`
+	} `json:"links"`
+}
+
+type bitbucketCloudPage struct {
+	Values []bitbucketCloudRepo `json:"values"`
+	Next   string               `json:"next"`
+}
+
+// Bitbucket Data Center repository, see /rest/api/1.0/projects/{key}/repos
+type bitbucketServerRepo struct {
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Public   bool   `json:"public"`
+	Archived bool   `json:"archived"`
+	Project  struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Self  []bitbucketLink `json:"self"`
+		Clone []bitbucketLink `json:"clone"`
+	} `json:"links"`
+}
+
+type bitbucketServerPage struct {
+	Values        []bitbucketServerRepo `json:"values"`
+	IsLastPage    bool                  `json:"isLastPage"`
+	NextPageStart int                   `json:"nextPageStart"`
+}
+
+type bitbucketServerCommits struct {
+	Values []struct {
+		CommitterTimestamp int64 `json:"committerTimestamp"`
+	} `json:"values"`
+}
+
+// Convert a Bitbucket Cloud repo to common Git Repo Struct
+func bitbucket_cloud_to_git(repo bitbucketCloudRepo, pat string, org OrgConfig) *GitRepo {
+	clone_url := ""
+	for _, link := range repo.Links.Clone {
+		if link.Name == "https" {
+			clone_url = link.Href
+		}
+	}
+	// cloud clone links include the user that made the request, drop it
+	if u, err := url.Parse(clone_url); err == nil {
+		u.User = nil
+		clone_url = u.String()
+	}
+	return &GitRepo{
+		Name:     repo.Name,
+		FullName: repo.FullName,
+		CloneURL: clone_url,
+		HTMLURL:  repo.Links.HTML.Href,
+		Private:  repo.IsPrivate,
+		orgname:  org.Name,
+		PushedAt: repo.UpdatedOn,
+		pat:      pat,
+		scanner:  org.Scanner,
+		provider: "BITBUCKET",
+	}
+}
+
+// Convert a Bitbucket Data Center repo to common Git Repo Struct
+func bitbucket_server_to_git(repo bitbucketServerRepo, pat string, org OrgConfig) *GitRepo {
+	clone_url := ""
+	for _, link := range repo.Links.Clone {
+		if link.Name == "http" || link.Name == "https" {
+			clone_url = link.Href
+		}
+	}
+	if u, err := url.Parse(clone_url); err == nil {
+		u.User = nil
+		clone_url = u.String()
+	}
+	html_url := ""
+	if len(repo.Links.Self) > 0 {
+		html_url = strings.TrimSuffix(repo.Links.Self[0].Href, "/browse")
+	}
+	return &GitRepo{
+		Name:     repo.Name,
+		FullName: fmt.Sprintf("%s/%s", repo.Project.Key, repo.Slug),
+		CloneURL: clone_url,
+		HTMLURL:  html_url,
+		Private:  !repo.Public,
+		orgname:  org.Name,
+		Archived: repo.Archived,
+		pat:      pat,
+		scanner:  org.Scanner,
+		provider: "BITBUCKET",
+		onprem:   true,
+	}
+}
+
+func bitbucket_headers(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// get_bitbucket_cloud_repos lists the repositories in a Bitbucket Cloud
+// workspace, most recently updated first
+func get_bitbucket_cloud_repos(ctx context.Context, org OrgConfig, pat string, daysago int, skipRepos []string) ([]*GitRepo, error) {
+	api := bitbucket_cloud_api
+	if org.BaseURL != "" {
+		api = strings.TrimSuffix(org.BaseURL, "/")
+	}
+	time_ago := time.Now().AddDate(0, 0, (-1 * daysago))
+	repos := make([]*GitRepo, 0)
+	next := fmt.Sprintf("%s/repositories/%s?pagelen=100&sort=-updated_on", api, url.PathEscape(org.Name))
+	for next != "" {
+		var page bitbucketCloudPage
+		if _, err := get_json(ctx, next, bitbucket_headers(pat), &page); err != nil {
+			return nil, err
+		}
+		saw_older := false
+		for _, repo := range page.Values {
+			if contains(skipRepos, repo.FullName) {
+				log.Debug().Str("repo", repo.FullName).Msg("skipping repo due to config")
+				continue
+			}
+			if daysago > 0 && repo.UpdatedOn.Before(time_ago) {
+				saw_older = true
+				break
+			}
+			repos = append(repos, bitbucket_cloud_to_git(repo, pat, org))
+		}
+		if saw_older {
+			break
+		}
+		next = page.Next
+	}
+	return repos, nil
+}
+
+// get_bitbucket_server_repos lists the repositories in a Bitbucket Data
+// Center project. DC doesn't report a last update time on the repo, so when
+// days_to_scan is set the latest commit on the default branch is checked.
+func get_bitbucket_server_repos(ctx context.Context, org OrgConfig, pat string, daysago int, skipRepos []string) ([]*GitRepo, error) {
+	if org.BaseURL == "" {
+		return nil, fmt.Errorf("Bitbucket on-prem org '%s' requires base_url", org.Name)
+	}
+	api := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos", strings.TrimSuffix(org.BaseURL, "/"), url.PathEscape(org.Name))
+	time_ago := time.Now().AddDate(0, 0, (-1 * daysago))
+	repos := make([]*GitRepo, 0)
+	start := 0
+	for {
+		var page bitbucketServerPage
+		if _, err := get_json(ctx, fmt.Sprintf("%s?limit=100&start=%d", api, start), bitbucket_headers(pat), &page); err != nil {
+			return nil, err
+		}
+		for _, repo := range page.Values {
+			g_repo := bitbucket_server_to_git(repo, pat, org)
+			if g_repo.Archived {
+				log.Debug().Str("repo", g_repo.FullName).Msg("skipping repo because it's archived")
+				continue
+			}
+			if contains(skipRepos, g_repo.FullName) {
+				log.Debug().Str("repo", g_repo.FullName).Msg("skipping repo due to config")
+				continue
+			}
+			if daysago > 0 {
+				var commits bitbucketServerCommits
+				commits_url := fmt.Sprintf("%s/%s/commits?limit=1", api, url.PathEscape(repo.Slug))
+				if _, err := get_json(ctx, commits_url, bitbucket_headers(pat), &commits); err != nil {
+					log.Warn().Err(err).Str("repo", g_repo.FullName).Msg("failed to get latest commit, scanning anyway")
+				} else if len(commits.Values) == 0 {
+					log.Debug().Str("repo", g_repo.FullName).Msg("skipping repo because it's empty")
+					continue
+				} else {
+					g_repo.PushedAt = time.UnixMilli(commits.Values[0].CommitterTimestamp)
+					if g_repo.PushedAt.Before(time_ago) {
+						continue
+					}
+				}
+			}
+			repos = append(repos, g_repo)
+		}
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	return repos, nil
+}
+
+// get_all_bitbucket_repos enumerates every configured workspace (cloud) or
+// project (onprem)
+func get_all_bitbucket_repos(ctx context.Context, orgs []OrgConfig, conf Conf) map[string]*GitRepo {
+	bitbucket_repos := make(map[string]*GitRepo)
+	for _, org := range orgs {
+		pat := getPat("BITBUCKET", org)
+		if pat == "" {
+			continue
+		}
+		var repos []*GitRepo
+		var err error
+		if org.Type == "onprem" {
+			repos, err = get_bitbucket_server_repos(ctx, org, pat, conf.BitbucketConfig.DaysToScan, conf.SkipRepos)
+		} else {
+			repos, err = get_bitbucket_cloud_repos(ctx, org, pat, conf.BitbucketConfig.DaysToScan, conf.SkipRepos)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("org", org.Name).Msg("Failed to get repos from Bitbucket. Continuing")
+			continue
+		}
+		log.Info().Str("org", org.Name).Str("type", org.Type).Int("repos", len(repos)).Msg("enumerated Bitbucket repos")
+		for _, repo := range repos {
+			bitbucket_repos[repo.HTMLURL] = repo
+		}
+	}
+	return bitbucket_repos
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBitbucketCloudRepos(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		repo := func(slug string, updated time.Time) map[string]interface{} {
+			return map[string]interface{}{
+				"name":       slug,
+				"slug":       slug,
+				"full_name":  "ws/" + slug,
+				"is_private": true,
+				"updated_on": updated.Format(time.RFC3339),
+				"links": map[string]interface{}{
+					"html":  map[string]string{"href": "https://bitbucket.org/ws/" + slug},
+					"clone": []map[string]string{{"name": "https", "href": "https://someone@bitbucket.org/ws/" + slug + ".git"}},
+				},
+			}
+		}
+		page := map[string]interface{}{}
+		if r.URL.Query().Get("page") == "" {
+			page["values"] = []interface{}{repo("one", time.Now()), repo("skipped", time.Now())}
+			page["next"] = fmt.Sprintf("%s/repositories/ws?page=2", srv.URL)
+		} else {
+			page["values"] = []interface{}{repo("two", time.Now().AddDate(0, 0, -2)), repo("old", time.Now().AddDate(0, 0, -30))}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	org := OrgConfig{Name: "ws", Type: "cloud", BaseURL: srv.URL}
+	repos, err := get_bitbucket_cloud_repos(context.Background(), org, "token", 7, []string{"ws/skipped"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("wanted 2 repos, got %d", len(repos))
+	}
+	if repos[0].CloneURL != "https://bitbucket.org/ws/one.git" {
+		t.Errorf("clone url should not contain a user, got %s", repos[0].CloneURL)
+	}
+	if repos[1].FullName != "ws/two" || repos[1].provider != "BITBUCKET" || repos[1].orgname != "ws" {
+		t.Errorf("repo converted wrong: %+v", repos[1])
+	}
+}
+
+func TestBitbucketServerRepos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/PROJ/repos":
+			repo := func(slug string, archived bool) map[string]interface{} {
+				return map[string]interface{}{
+					"name":     slug,
+					"slug":     slug,
+					"public":   false,
+					"archived": archived,
+					"project":  map[string]string{"key": "PROJ"},
+					"links": map[string]interface{}{
+						"self":  []map[string]string{{"href": "https://bb.example.com/projects/PROJ/repos/" + slug + "/browse"}},
+						"clone": []map[string]string{{"name": "http", "href": "https://bb.example.com/scm/proj/" + slug + ".git"}, {"name": "ssh", "href": "ssh://git@bb.example.com:7999/proj/" + slug + ".git"}},
+					},
+				}
+			}
+			if r.URL.Query().Get("start") == "0" {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"values": []interface{}{repo("one", false), repo("archived", true)}, "isLastPage": false, "nextPageStart": 2,
+				})
+			} else {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"values": []interface{}{repo("stale", false)}, "isLastPage": true,
+				})
+			}
+		case "/rest/api/1.0/projects/PROJ/repos/one/commits":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"values": []map[string]int64{{"committerTimestamp": time.Now().UnixMilli()}},
+			})
+		case "/rest/api/1.0/projects/PROJ/repos/stale/commits":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"values": []map[string]int64{{"committerTimestamp": time.Now().AddDate(-1, 0, 0).UnixMilli()}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	org := OrgConfig{Name: "PROJ", Type: "onprem", BaseURL: srv.URL}
+	repos, err := get_bitbucket_server_repos(context.Background(), org, "token", 7, []string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 1 {
+		t.Fatalf("wanted 1 repo, got %d", len(repos))
+	}
+	if repos[0].HTMLURL != "https://bb.example.com/projects/PROJ/repos/one" {
+		t.Errorf("wrong html url %s", repos[0].HTMLURL)
+	}
+	if repos[0].CloneURL != "https://bb.example.com/scm/proj/one.git" {
+		t.Errorf("wrong clone url %s", repos[0].CloneURL)
+	}
+	if _, err := get_bitbucket_server_repos(context.Background(), OrgConfig{Name: "PROJ", Type: "onprem"}, "token", 0, nil); err == nil {
+		t.Errorf("onprem without base_url should error")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cache_locks holds a mutex per cached repo so two scans never fetch into,
+// scan, or evict the same mirror at once
+var cache_locks sync.Map
+
+// lock_cache_entry locks a mirror against other scans in this process and,
+// through a flock on <entry>.lock, against other MOSS runs sharing the
+// cache dir
+func lock_cache_entry(path string) (func(), error) {
+	mu, _ := cache_locks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	unlock_file, err := lock_file(path + ".lock")
+	if err != nil {
+		mu.(*sync.Mutex).Unlock()
+		return nil, err
+	}
+	return func() {
+		unlock_file()
+		mu.(*sync.Mutex).Unlock()
+	}, nil
+}
+
+// cache_entry_path returns where the mirror of a repo is kept
+func cache_entry_path(cache_dir string, repo *GitRepo) string {
+	sum := sha256.Sum256([]byte(repo.CloneURL))
+	name := strings.ReplaceAll(repo.Name, string(os.PathSeparator), "_")
+	return filepath.Join(cache_dir, fmt.Sprintf("%s-%s.git", name, hex.EncodeToString(sum[:6])))
+}
+
+// cache_refspecs are the refs kept in cached clones. A --mirror clone would
+// also fetch refs/pull/* and the like, so scans would pick up commits from
+// every pull request ever opened, including ones from forks.
+var cache_refspecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+// is_healthy_mirror does a cheap check that the mirror is a usable repo
+func is_healthy_mirror(path string) bool {
+	return exec.Command("git", "-C", path, "rev-parse", "--git-dir").Run() == nil
+}
+
+func mirror_clone(ctx context.Context, repo *GitRepo, path string) error {
+	err := run_git(ctx, repo, "clone", "--quiet", "--bare", repo.CloneURL, path)
+	for _, refspec := range cache_refspecs {
+		if err != nil {
+			break
+		}
+		err = run_git(ctx, repo, "-C", path, "config", "--add", "remote.origin.fetch", refspec)
+	}
+	if err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	return nil
+}
+
+func mirror_fetch(ctx context.Context, repo *GitRepo, path string) error {
+	return run_git(ctx, repo, "-C", path, "fetch", "--prune", "--quiet", "origin")
+}
+
+// cached_clone brings the cached mirror of a repo up to date, cloning it if
+// it isn't cached yet and re-cloning it if it's corrupt. The returned
+// function releases the entry and must be called once scanning is done.
+func cached_clone(ctx context.Context, repo *GitRepo, cache_dir string) (string, func(), error) {
+	if err := os.MkdirAll(cache_dir, 0700); err != nil {
+		return "", nil, err
+	}
+	path := cache_entry_path(cache_dir, repo)
+	unlock, err := lock_cache_entry(path)
+	if err != nil {
+		return "", nil, err
+	}
+	fail := func(err error) (string, func(), error) {
+		unlock()
+		return "", nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if is_healthy_mirror(path) && mirror_fetch(ctx, repo, path) == nil {
+			log.Debug().Str("repo", repo.Name).Str("path", path).Msg("updated cached clone")
+			touch_cache_entry(path)
+			return path, unlock, nil
+		}
+		log.Warn().Str("repo", repo.Name).Str("path", path).Msg("cached clone is unusable, re-cloning")
+		if err := os.RemoveAll(path); err != nil {
+			return fail(err)
+		}
+	}
+	if err := mirror_clone(ctx, repo, path); err != nil {
+		return fail(err)
+	}
+	log.Debug().Str("repo", repo.Name).Str("path", path).Msg("cloned into cache")
+	touch_cache_entry(path)
+	return path, unlock, nil
+}
+
+// touch_cache_entry marks an entry as recently used for LRU eviction
+func touch_cache_entry(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+func dir_size(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+type cacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// evict_clone_cache removes the least recently used mirrors until the cache
+// fits in max_bytes. A max of 0 or less leaves the cache unbounded.
+func evict_clone_cache(cache_dir string, max_bytes int64) error {
+	if max_bytes <= 0 {
+		return nil
+	}
+	dirents, err := os.ReadDir(cache_dir)
+	if err != nil {
+		return err
+	}
+	entries := make([]cacheEntry, 0)
+	var total int64
+	for _, d := range dirents {
+		if !d.IsDir() || !strings.HasSuffix(d.Name(), ".git") {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(cache_dir, d.Name())
+		entry := cacheEntry{path: path, size: dir_size(path), lastUsed: info.ModTime()}
+		total += entry.size
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+	for _, entry := range entries {
+		if total <= max_bytes {
+			break
+		}
+		unlock, err := lock_cache_entry(entry.path)
+		if err == nil {
+			err = os.RemoveAll(entry.path)
+			unlock()
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("path", entry.path).Msg("failed to evict cached clone")
+			continue
+		}
+		log.Debug().Str("path", entry.path).Int64("bytes", entry.size).Msg("evicted cached clone")
+		total -= entry.size
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachedClone(t *testing.T) {
+	origin := gitRepoWithCommit(t)
+	cache_dir := t.TempDir()
+	repo := &GitRepo{Name: "origin", CloneURL: origin, provider: "GIT"}
+
+	path, release, err := cached_clone(context.Background(), repo, cache_dir)
+	if err != nil {
+		t.Fatalf("failed to clone into cache: %v", err)
+	}
+	release()
+	heads, err := git_branch_heads(path)
+	if err != nil || heads["refs/heads/main"] == "" {
+		t.Fatalf("mirror is missing the main branch: %v %v", heads, err)
+	}
+	// a second run fetches into the same mirror
+	again, release, err := cached_clone(context.Background(), repo, cache_dir)
+	if err != nil || again != path {
+		t.Fatalf("expected the cached mirror to be reused, got %s %v", again, err)
+	}
+	release()
+	// only branches and tags are cached, not pull request refs
+	run := func(dir string, args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run(origin, "update-ref", "refs/pull/1/head", "HEAD")
+	run(origin, "tag", "v1")
+	run(origin, "branch", "feature")
+	_, release, err = cached_clone(context.Background(), repo, cache_dir)
+	if err != nil {
+		t.Fatalf("failed to update the cached clone: %v", err)
+	}
+	release()
+	refs := run(path, "for-each-ref", "--format=%(refname)")
+	if strings.Contains(refs, "refs/pull/") || !strings.Contains(refs, "refs/tags/v1") || !strings.Contains(refs, "refs/heads/feature") {
+		t.Errorf("cached clone has the wrong refs:\n%s", refs)
+	}
+	// deleted branches are pruned
+	run(origin, "branch", "-D", "feature")
+	_, release, err = cached_clone(context.Background(), repo, cache_dir)
+	if err != nil {
+		t.Fatalf("failed to update the cached clone: %v", err)
+	}
+	release()
+	if refs := run(path, "for-each-ref", "--format=%(refname)"); strings.Contains(refs, "refs/heads/feature") {
+		t.Errorf("deleted branch wasn't pruned:\n%s", refs)
+	}
+	// a corrupt mirror is re-cloned
+	if err := os.Remove(filepath.Join(path, "HEAD")); err != nil {
+		t.Fatalf("failed to corrupt mirror: %v", err)
+	}
+	_, release, err = cached_clone(context.Background(), repo, cache_dir)
+	if err != nil {
+		t.Fatalf("failed to re-clone a corrupt mirror: %v", err)
+	}
+	release()
+	if !is_healthy_mirror(path) {
+		t.Errorf("mirror wasn't repaired")
+	}
+}
+
+func TestEvictCloneCache(t *testing.T) {
+	cache_dir := t.TempDir()
+	for i, name := range []string{"old.git", "new.git"} {
+		entry := filepath.Join(cache_dir, name)
+		if err := os.MkdirAll(entry, 0700); err != nil {
+			t.Fatalf("failed to create entry: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(entry, "pack"), make([]byte, 1024), 0600); err != nil {
+			t.Fatalf("failed to write entry: %v", err)
+		}
+		used := time.Now().Add(time.Duration(i-2) * time.Hour)
+		os.Chtimes(entry, used, used)
+	}
+	if err := evict_clone_cache(cache_dir, 1500); err != nil {
+		t.Fatalf("eviction failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache_dir, "old.git")); !os.IsNotExist(err) {
+		t.Errorf("least recently used entry should be evicted")
+	}
+	if _, err := os.Stat(filepath.Join(cache_dir, "new.git")); err != nil {
+		t.Errorf("most recently used entry should be kept")
+	}
+}
+
+func TestEvictWaitsForOtherRuns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no flock on windows")
+	}
+	cache_dir := t.TempDir()
+	entry := filepath.Join(cache_dir, "busy.git")
+	if err := os.MkdirAll(entry, 0700); err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(entry, "pack"), make([]byte, 1024), 0600); err != nil {
+		t.Fatalf("failed to write entry: %v", err)
+	}
+	// another run holds the entry's lock file while it scans the mirror
+	unlock, err := lock_file(entry + ".lock")
+	if err != nil {
+		t.Fatalf("failed to lock entry: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- evict_clone_cache(cache_dir, 1) }()
+	select {
+	case <-done:
+		t.Fatalf("eviction didn't wait for the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(entry); err != nil {
+		t.Errorf("locked entry was evicted")
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("eviction failed: %v", err)
+	}
+	if _, err := os.Stat(entry); !os.IsNotExist(err) {
+		t.Errorf("entry should be evicted once unlocked")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const checkpoint_manifest_name = "manifest.json"
+
+// checkpointRepo is a repo as written to the run manifest. The PAT isn't
+// written, it's read from the environment again on resume.
+type checkpointRepo struct {
+	Name      string
+	FullName  string
+	CloneURL  string
+	HTMLURL   string
+	Private   bool
+	Archived  bool
+	PushedAt  time.Time
+	Org       string
+	Provider  string
+	LocalPath string `json:",omitempty"`
+	Scanner   string `json:",omitempty"`
+	OnPrem    bool   `json:",omitempty"`
+}
+
+func new_checkpoint_repo(repo *GitRepo) checkpointRepo {
+	return checkpointRepo{
+		Name:      repo.Name,
+		FullName:  repo.FullName,
+		CloneURL:  repo.CloneURL,
+		HTMLURL:   repo.HTMLURL,
+		Private:   repo.Private,
+		Archived:  repo.Archived,
+		PushedAt:  repo.PushedAt,
+		Org:       repo.orgname,
+		Provider:  repo.provider,
+		LocalPath: repo.localPath,
+		Scanner:   repo.scanner,
+		OnPrem:    repo.onprem,
+	}
+}
+
+func (c checkpointRepo) git_repo() *GitRepo {
+	repo := &GitRepo{
+		Name:      c.Name,
+		FullName:  c.FullName,
+		CloneURL:  c.CloneURL,
+		HTMLURL:   c.HTMLURL,
+		Private:   c.Private,
+		Archived:  c.Archived,
+		PushedAt:  c.PushedAt,
+		orgname:   c.Org,
+		provider:  c.Provider,
+		localPath: c.LocalPath,
+		scanner:   c.Scanner,
+		onprem:    c.OnPrem,
+	}
+	// local paths and plain git remotes are cloned without a PAT
+	if c.Provider != "LOCAL" && c.Provider != "GIT" {
+		repo.pat = getPat(c.Provider, OrgConfig{Name: c.Org})
+	}
+	return repo
+}
+
+// runManifest lists the repos a run set out to scan
+type runManifest struct {
+	ID      string
+	Started time.Time
+	Repos   []checkpointRepo
+}
+
+// runCheckpoint keeps a run's manifest along with the raw result of every
+// repo it has finished, one file each so recording one is a single write
+type runCheckpoint struct {
+	dir      string
+	manifest runManifest
+}
+
+// checkpoint_base_dir is where runs are checkpointed. Checkpoints hold
+// unredacted secrets, so they're kept out of the output dir, which is often
+// published: next to the incremental state if there is one, else in the
+// temp dir.
+func checkpoint_base_dir(conf Conf) string {
+	switch {
+	case conf.CheckpointDir != "":
+		return conf.CheckpointDir
+	case conf.Incremental.StateDir != "":
+		return filepath.Join(conf.Incremental.StateDir, "runs")
+	}
+	return filepath.Join(os.TempDir(), "moss-runs")
+}
+
+// new_run_id names a run after when it started
+func new_run_id(now time.Time) string {
+	buf := make([]byte, 3)
+	rand.Read(buf)
+	return fmt.Sprintf("%s-%s", now.UTC().Format("20060102T150405Z"), hex.EncodeToString(buf))
+}
+
+func checkpoint_dir(base_dir string, id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid run id %q", id)
+	}
+	return filepath.Join(base_dir, id), nil
+}
+
+// create_checkpoint writes the manifest for a new run
+func create_checkpoint(base_dir string, id string, started time.Time, repos map[string]*GitRepo) (*runCheckpoint, error) {
+	dir, err := checkpoint_dir(base_dir, id)
+	if err != nil {
+		return nil, err
+	}
+	c := &runCheckpoint{dir: dir, manifest: runManifest{ID: id, Started: started, Repos: make([]checkpointRepo, 0, len(repos))}}
+	urls := make([]string, 0, len(repos))
+	for url := range repos {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		c.manifest.Repos = append(c.manifest.Repos, new_checkpoint_repo(repos[url]))
+	}
+	contents, err := json.Marshal(c.manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := write_file_atomic(filepath.Join(dir, checkpoint_manifest_name), contents); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// open_checkpoint loads the manifest of an earlier run
+func open_checkpoint(base_dir string, id string) (*runCheckpoint, error) {
+	dir, err := checkpoint_dir(base_dir, id)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(filepath.Join(dir, checkpoint_manifest_name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no checkpoint for run %s in %s", id, base_dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &runCheckpoint{dir: dir}
+	if err := json.Unmarshal(contents, &c.manifest); err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of run %s: %w", id, err)
+	}
+	return c, nil
+}
+
+// repos returns the repos in the manifest keyed by url, like get_all_repos
+func (c *runCheckpoint) repos() map[string]*GitRepo {
+	repos := make(map[string]*GitRepo)
+	for _, repo := range c.manifest.Repos {
+		repos[repo.HTMLURL] = repo.git_repo()
+	}
+	return repos
+}
+
+// orgs returns the orgs of the repos in the manifest, so a resumed run
+// reports on the same orgs whatever the config or flags say now. Orgs are
+// in the order of ordered, any it doesn't list follow sorted by name.
+func (c *runCheckpoint) orgs(ordered []string) []string {
+	seen := make(map[string]bool)
+	for _, repo := range c.manifest.Repos {
+		seen[repo.Org] = true
+	}
+	orgs := make([]string, 0, len(seen))
+	for _, org := range ordered {
+		if seen[org] {
+			orgs = append(orgs, org)
+			delete(seen, org)
+		}
+	}
+	rest := make([]string, 0, len(seen))
+	for org := range seen {
+		rest = append(rest, org)
+	}
+	sort.Strings(rest)
+	return append(orgs, rest...)
+}
+
+func (c *runCheckpoint) result_path(repo_url string) string {
+	sum := sha256.Sum256([]byte(repo_url))
+	return filepath.Join(c.dir, "results", hex.EncodeToString(sum[:])+".json")
+}
+
+// complete records a repo's result before any filtering, so resuming
+// filters it against the config the same way the rest are. Failed repos
+// aren't recorded and are scanned again on resume.
+func (c *runCheckpoint) complete(result GitleaksRepoResult) error {
+	if result.Err != nil {
+		return nil
+	}
+	contents, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return write_file_atomic(c.result_path(result.URL), contents)
+}
+
+// completed returns the recorded results of the repos in the manifest
+func (c *runCheckpoint) completed() map[string]GitleaksRepoResult {
+	done := make(map[string]GitleaksRepoResult)
+	for _, repo := range c.manifest.Repos {
+		contents, err := os.ReadFile(c.result_path(repo.HTMLURL))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		var result GitleaksRepoResult
+		if err == nil {
+			err = json.Unmarshal(contents, &result)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("repo", repo.FullName).Msg("failed to read checkpointed result, scanning the repo again")
+			continue
+		}
+		done[repo.HTMLURL] = result
+	}
+	return done
+}
+
+// remove deletes the checkpoint once the run has written its reports
+func (c *runCheckpoint) remove() error {
+	return os.RemoveAll(c.dir)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	t.Setenv("GITHUB_PAT_org", "token")
+	base := t.TempDir()
+	repos := map[string]*GitRepo{
+		"https://github.com/org/repo":  {Name: "repo", HTMLURL: "https://github.com/org/repo", orgname: "org", provider: "GITHUB", pat: "token", scanner: "native"},
+		"https://github.com/org/other": {Name: "other", HTMLURL: "https://github.com/org/other", orgname: "org", provider: "GITHUB", pat: "token"},
+		"https://github.com/org/fails": {Name: "fails", HTMLURL: "https://github.com/org/fails", orgname: "org", provider: "GITHUB", pat: "token"},
+	}
+	id := new_run_id(time.Now())
+	checkpoint, err := create_checkpoint(base, id, time.Now(), repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.complete(getRepoResult()); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoint.complete(GitleaksRepoResult{Repository: "fails", URL: "https://github.com/org/fails", Err: errors.New("clone failed")}); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := open_checkpoint(base, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := resumed.repos()
+	if len(restored) != 3 {
+		t.Fatalf("expected the 3 enumerated repos, got %d", len(restored))
+	}
+	repo := restored["https://github.com/org/repo"]
+	if repo.orgname != "org" || repo.scanner != "native" || repo.pat != "token" {
+		t.Errorf("repo wasn't restored, got %+v", repo)
+	}
+	if orgs := resumed.orgs(nil); len(orgs) != 1 || orgs[0] != "org" {
+		t.Errorf("expected the manifest's org, got %v", orgs)
+	}
+	done := resumed.completed()
+	if len(done) != 1 {
+		t.Fatalf("only the successful repo should be completed, got %d", len(done))
+	}
+	result := done["https://github.com/org/repo"]
+	if result.Err != nil || len(result.Results) != 1 || result.Results[0].Secret != getRepoResult().Results[0].Secret {
+		t.Errorf("unexpected checkpointed result %+v", result)
+	}
+
+	if err := resumed.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(resumed.dir); !os.IsNotExist(err) {
+		t.Error("checkpoint wasn't removed")
+	}
+	if _, err := open_checkpoint(base, id); err == nil {
+		t.Error("expected an error resuming a removed run")
+	}
+	if _, err := open_checkpoint(base, "../escape"); err == nil {
+		t.Error("expected an error for a run id with a path in it")
+	}
+}
+
+func TestCheckpointOrgs(t *testing.T) {
+	repos := map[string]*GitRepo{
+		"a": {HTMLURL: "a", orgname: "local", provider: "LOCAL"},
+		"b": {HTMLURL: "b", orgname: "removed", provider: "LOCAL"},
+		"c": {HTMLURL: "c", orgname: "kept", provider: "LOCAL"},
+	}
+	checkpoint, err := create_checkpoint(t.TempDir(), new_run_id(time.Now()), time.Now(), repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// orgs since dropped from the config or only given by flags are kept,
+	// orgs only in the config now are left out
+	orgs := checkpoint.orgs([]string{"added", "kept"})
+	if strings.Join(orgs, ",") != "kept,local,removed" {
+		t.Errorf("unexpected orgs %v", orgs)
+	}
+}
+
+func TestCheckpointBaseDir(t *testing.T) {
+	t.Setenv("TMPDIR", "/tmp/moss-test")
+	for _, tt := range []struct {
+		conf Conf
+		want string
+	}{
+		{Conf{CheckpointDir: "/ckpt", Incremental: ConfIncremental{StateDir: "/state"}}, "/ckpt"},
+		{Conf{Incremental: ConfIncremental{StateDir: "/state"}}, "/state/runs"},
+		{Conf{}, "/tmp/moss-test/moss-runs"},
+	} {
+		if got := checkpoint_base_dir(tt.conf); got != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, got)
+		}
+	}
+}
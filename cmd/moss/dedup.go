@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// secret_hash identifies a secret without revealing it. The salt keeps
+// short or guessable secrets from being brute forced out of a report.
+func secret_hash(salt string, secret string) string {
+	if secret == "" {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s", salt, secret)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// setup_secret_salt picks the salt secrets are hashed with. Without a
+// configured salt a random one is used, so hashes only match within a run.
+func (c *Conf) setup_secret_salt() {
+	if salt := os.Getenv("MOSS_SECRET_SALT"); salt != "" {
+		c.SecretHashSalt = salt
+	}
+	c.secret_salt = c.SecretHashSalt
+	if c.secret_salt != "" {
+		return
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatal().Err(err).Msg("failed to generate a secret hash salt")
+	}
+	c.secret_salt = hex.EncodeToString(buf)
+	log.Info().Msg("no secret_hash_salt configured, secret hashes won't match across runs")
+}
+
+// hashSecrets sets the salted hash of every finding's secret, suppressed
+// findings included
+func (r *GitleaksRepoResult) hashSecrets(salt string) {
+	for i := range r.Results {
+		r.Results[i].SecretHash = secret_hash(salt, r.Results[i].Secret)
+	}
+	for i := range r.Suppressed {
+		r.Suppressed[i].SecretHash = secret_hash(salt, r.Suppressed[i].Secret)
+	}
+}
+
+// SecretLocation is one place a unique secret was found
+type SecretLocation struct {
+	Org        string
+	Repository string
+	URL        string
+	Provider   string `json:",omitempty"`
+	File       string
+	StartLine  int
+	Commit     string
+	Date       string
+	Author     string
+}
+
+// UniqueSecret is a secret found one or more times across all repos
+type UniqueSecret struct {
+	Hash      string
+	RuleIDs   []string
+	Repos     []string
+	Locations []SecretLocation
+	// FirstSeen is the earliest commit date the secret was found at
+	FirstSeen      string
+	EarliestAuthor string
+	EarliestEmail  string
+}
+
+// finding_before orders commit dates, falling back to comparing the strings
+// for dates that don't parse
+func finding_before(a string, b string) bool {
+	ta, err_a := parse_finding_date(a)
+	tb, err_b := parse_finding_date(b)
+	if err_a == nil && err_b == nil {
+		return ta.Before(tb)
+	}
+	return a < b
+}
+
+// dedup_secrets groups findings by secret hash, so a leaked credential that
+// was copied across repos shows up once with everywhere it appears
+func dedup_secrets(results []GitleaksRepoResult, orgs []string) []UniqueSecret {
+	json_res := get_json_obj(results, orgs)
+	by_hash := make(map[string]*UniqueSecret)
+	for _, org := range orgs {
+		for _, repo_result := range json_res[org] {
+			for _, finding := range repo_result.Results {
+				if finding.SecretHash == "" {
+					continue
+				}
+				u, ok := by_hash[finding.SecretHash]
+				if !ok {
+					u = &UniqueSecret{Hash: finding.SecretHash, FirstSeen: finding.Date, EarliestAuthor: finding.Author, EarliestEmail: finding.Email}
+					by_hash[finding.SecretHash] = u
+				}
+				if !contains(u.RuleIDs, finding.RuleID) {
+					u.RuleIDs = append(u.RuleIDs, finding.RuleID)
+				}
+				full_name := fmt.Sprintf("%s/%s", org, repo_result.Repository)
+				if !contains(u.Repos, full_name) {
+					u.Repos = append(u.Repos, full_name)
+				}
+				u.Locations = append(u.Locations, SecretLocation{
+					Org:        org,
+					Repository: repo_result.Repository,
+					URL:        repo_result.URL,
+					Provider:   repo_result.Provider,
+					File:       finding.File,
+					StartLine:  finding.StartLine,
+					Commit:     finding.Commit,
+					Date:       finding.Date,
+					Author:     finding.Author,
+				})
+				if finding.Date != "" && (u.FirstSeen == "" || finding_before(finding.Date, u.FirstSeen)) {
+					u.FirstSeen = finding.Date
+					u.EarliestAuthor = finding.Author
+					u.EarliestEmail = finding.Email
+				}
+			}
+		}
+	}
+	unique := make([]UniqueSecret, 0, len(by_hash))
+	for _, u := range by_hash {
+		unique = append(unique, *u)
+	}
+	// secrets spread the widest are the most urgent
+	sort.Slice(unique, func(i, j int) bool {
+		if len(unique[i].Repos) != len(unique[j].Repos) {
+			return len(unique[i].Repos) > len(unique[j].Repos)
+		}
+		if len(unique[i].Locations) != len(unique[j].Locations) {
+			return len(unique[i].Locations) > len(unique[j].Locations)
+		}
+		return unique[i].Hash < unique[j].Hash
+	})
+	return unique
+}
+
+// short_hash is the abbreviated secret hash used for display
+func short_hash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func unique_secrets_markdown(unique []UniqueSecret) string {
+	if len(unique) == 0 {
+		return ""
+	}
+	rows := ""
+	for _, u := range unique {
+		locations := make([]string, 0, len(u.Locations))
+		for _, l := range u.Locations {
+			locations = append(locations, fmt.Sprintf("%s/%s:%s:%d@%s", l.Org, l.Repository, l.File, l.StartLine,
+				commit_link_markdown(l.Provider, l.URL, l.Commit)))
+		}
+		rows = fmt.Sprintf("%s|%s|%s|%d|%s|%s|%s|\n", rows, short_hash(u.Hash), strings.Join(u.RuleIDs, ", "), len(u.Repos),
+			strings.Join(locations, "<br>"), u.FirstSeen, u.EarliestAuthor)
+	}
+	return fmt.Sprintf("## Unique Secrets\n<details>\n  <summary>%d unique secrets</summary>\n\n"+
+		"|Secret Hash|Rules|Repos|Locations|First Seen|Earliest Author|\n|-----------|-----|-----|---------|----------|---------------|\n%s\n</details>\n\n",
+		len(unique), rows)
+}
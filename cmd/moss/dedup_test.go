@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretHash(t *testing.T) {
+	if secret_hash("salt", "secret") != secret_hash("salt", "secret") {
+		t.Error("hashing isn't deterministic")
+	}
+	if secret_hash("salt", "secret") == secret_hash("other", "secret") {
+		t.Error("the salt didn't change the hash")
+	}
+	if secret_hash("salt", "") != "" {
+		t.Error("empty secrets shouldn't be hashed")
+	}
+}
+
+func TestDedupSecrets(t *testing.T) {
+	first := getRepoResult()
+	second := getRepoResult()
+	second.Repository = "other"
+	second.URL = "https://github.com/org/other"
+	second.Results[0].Date = "2019-01-02T03:04:05Z"
+	second.Results[0].Author = "Early Bird"
+	second.Results = append(second.Results, GitleaksResult{Secret: "another", File: "x", RuleID: "aws-access-token", Date: "2022-01-01T00:00:00Z"})
+	results := []GitleaksRepoResult{first, second}
+	for i := range results {
+		results[i].hashSecrets("salt")
+	}
+
+	unique := dedup_secrets(results, []string{"org"})
+	if len(unique) != 2 {
+		t.Fatalf("expected 2 unique secrets, got %d", len(unique))
+	}
+	shared := unique[0]
+	if len(shared.Repos) != 2 || len(shared.Locations) != 2 {
+		t.Errorf("expected the shared secret in 2 repos, got %v", shared.Repos)
+	}
+	if shared.FirstSeen != "2019-01-02T03:04:05Z" || shared.EarliestAuthor != "Early Bird" {
+		t.Errorf("wrong first sighting: %s by %s", shared.FirstSeen, shared.EarliestAuthor)
+	}
+	if shared.Hash != secret_hash("salt", first.Results[0].Secret) {
+		t.Error("unexpected hash for the shared secret")
+	}
+
+	md := unique_secrets_markdown(unique)
+	if !strings.Contains(md, "## Unique Secrets") || strings.Contains(md, first.Results[0].Secret) {
+		t.Errorf("bad unique secrets section:\n%s", md)
+	}
+	sarif := sarif_output(results, []string{"org"}, nil, reportExtras{UniqueSecrets: unique})
+	if !strings.Contains(sarif, `"mossUniqueSecrets"`) || !strings.Contains(sarif, shared.Hash) {
+		t.Error("sarif output is missing the unique secrets")
+	}
+}
+
+func TestJsonReportLoadsAsBaseline(t *testing.T) {
+	results := []GitleaksRepoResult{getRepoResult()}
+	results[0].hashSecrets("salt")
+	path := filepath.Join(t.TempDir(), "output.json")
+	extras := reportExtras{UniqueSecrets: dedup_secrets(results, []string{"org"})}
+	if err := write_file_atomic(path, []byte(json_report(results, []string{"org"}, extras))); err != nil {
+		t.Fatal(err)
+	}
+	orgs, err := load_json_output(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || len(orgs["org"]) != 1 {
+		t.Errorf("expected just the org to be read back, got %v", orgs)
+	}
+}
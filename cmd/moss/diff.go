@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// repoDiff is how one repository's findings changed between two runs
+type repoDiff struct {
+	Repository string
+	URL        string
+	Provider   string `json:",omitempty"`
+	New        []GitleaksResult
+	Fixed      []GitleaksResult
+	Existing   []GitleaksResult
+	// NotCompared is why the repo was skipped, set when its scan didn't
+	// finish in one of the runs
+	NotCompared string `json:",omitempty"`
+}
+
+type diffReport struct {
+	New         int
+	Fixed       int
+	Existing    int
+	NotCompared int
+	Orgs        map[string][]repoDiff
+}
+
+// diff_repo_key matches repos across runs on their url, falling back to the
+// name for repos without one
+func diff_repo_key(repo savedRepoResult) string {
+	if repo.URL != "" {
+		return repo.URL
+	}
+	return repo.Repository
+}
+
+// diff_results compares two json outputs. Findings are matched on their
+// fingerprint, so a finding is fixed once a later run no longer reports it.
+// Repos whose scan failed, timed out or was canceled in either run aren't
+// compared, their missing findings say nothing about what was fixed.
+func diff_results(old map[string][]savedRepoResult, cur map[string][]savedRepoResult) diffReport {
+	report := diffReport{Orgs: make(map[string][]repoDiff)}
+	orgs := make(map[string]bool)
+	for org := range old {
+		orgs[org] = true
+	}
+	for org := range cur {
+		orgs[org] = true
+	}
+	for org := range orgs {
+		repos := make(map[string]*repoDiff)
+		// fingerprints reported by the old and new run, per repo
+		old_fps := make(map[string]map[string]GitleaksResult)
+		new_fps := make(map[string]map[string]GitleaksResult)
+		collect := func(results []savedRepoResult, fps map[string]map[string]GitleaksResult, run string) {
+			for _, repo := range results {
+				key := diff_repo_key(repo)
+				if _, ok := repos[key]; !ok {
+					repos[key] = &repoDiff{Repository: repo.Repository, URL: repo.URL, Provider: repo.Provider}
+				}
+				if reason := repo.incomplete(); reason != "" && repos[key].NotCompared == "" {
+					repos[key].NotCompared = fmt.Sprintf("scan %s in the %s run", reason, run)
+				}
+				if fps[key] == nil {
+					fps[key] = make(map[string]GitleaksResult)
+				}
+				for _, finding := range repo.Results {
+					fps[key][finding.fingerprint(repo.URL)] = finding
+				}
+			}
+		}
+		collect(old[org], old_fps, "old")
+		collect(cur[org], new_fps, "new")
+		keys := make([]string, 0, len(repos))
+		for key := range repos {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		org_diffs := make([]repoDiff, 0)
+		for _, key := range keys {
+			diff := repos[key]
+			if diff.NotCompared != "" {
+				report.NotCompared = report.NotCompared + 1
+				org_diffs = append(org_diffs, *diff)
+				continue
+			}
+			for _, fp := range sorted_keys(new_fps[key]) {
+				if _, ok := old_fps[key][fp]; ok {
+					diff.Existing = append(diff.Existing, new_fps[key][fp])
+				} else {
+					diff.New = append(diff.New, new_fps[key][fp])
+				}
+			}
+			for _, fp := range sorted_keys(old_fps[key]) {
+				if _, ok := new_fps[key][fp]; !ok {
+					diff.Fixed = append(diff.Fixed, old_fps[key][fp])
+				}
+			}
+			if len(diff.New)+len(diff.Fixed)+len(diff.Existing) == 0 {
+				continue
+			}
+			report.New = report.New + len(diff.New)
+			report.Fixed = report.Fixed + len(diff.Fixed)
+			report.Existing = report.Existing + len(diff.Existing)
+			org_diffs = append(org_diffs, *diff)
+		}
+		report.Orgs[org] = org_diffs
+	}
+	return report
+}
+
+// sorted_keys keeps diff output stable between runs
+func sorted_keys(findings map[string]GitleaksResult) []string {
+	keys := make([]string, 0, len(findings))
+	for key := range findings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func diff_json_output(report diffReport) string {
+	j_string, err := json.Marshal(report)
+	if err != nil {
+		log.Fatal().Msg("Failed to marshal diff results")
+	}
+	return string(j_string)
+}
+
+func diff_markdown_table(findings []GitleaksResult, provider string, repo_url string) string {
+	table := "|File|Type|Lines|Commit|Author|\n|----|----|-----|------|------|\n"
+	for _, finding := range findings {
+		commit_link := commit_link_markdown(provider, repo_url, finding.Commit)
+		table = fmt.Sprintf("%s|%s|%s|%d-%d|%s|%s|\n", table, finding.File, finding.Description,
+			finding.StartLine, finding.EndLine, commit_link, finding.Author)
+	}
+	return table
+}
+
+func diff_markdown_output(report diffReport) string {
+	markdown_out := "# MOSS Diff\n"
+	markdown_out = fmt.Sprintf("%s%d new, %d fixed, %d still present\n", markdown_out, report.New, report.Fixed, report.Existing)
+	if report.NotCompared > 0 {
+		markdown_out = fmt.Sprintf("%s%d repos not compared because their scan didn't finish\n", markdown_out, report.NotCompared)
+	}
+	orgs := make([]string, 0, len(report.Orgs))
+	for org := range report.Orgs {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+	for _, org := range orgs {
+		markdown_out = fmt.Sprintf("%s## %s\n", markdown_out, org)
+		if len(report.Orgs[org]) == 0 {
+			markdown_out = fmt.Sprintf("%sNo findings!\n", markdown_out)
+			continue
+		}
+		for _, diff := range report.Orgs[org] {
+			markdown_out = fmt.Sprintf("%s### %s\n", markdown_out, diff.Repository)
+			if diff.NotCompared != "" {
+				markdown_out = fmt.Sprintf("%sNot compared, the %s\n\n", markdown_out, diff.NotCompared)
+				continue
+			}
+			markdown_out = fmt.Sprintf("%s%d new, %d fixed, %d still present\n\n", markdown_out, len(diff.New), len(diff.Fixed), len(diff.Existing))
+			if len(diff.New) > 0 {
+				markdown_out = fmt.Sprintf("%s#### New\n%s\n", markdown_out, diff_markdown_table(diff.New, diff.Provider, diff.URL))
+			}
+			if len(diff.Fixed) > 0 {
+				markdown_out = fmt.Sprintf("%s#### Fixed\n%s\n", markdown_out, diff_markdown_table(diff.Fixed, diff.Provider, diff.URL))
+			}
+			// still present findings are the least interesting, keep them folded
+			if len(diff.Existing) > 0 {
+				markdown_out = fmt.Sprintf("%s<details>\n  <summary>Still present</summary>\n\n%s\n</details>\n\n",
+					markdown_out, diff_markdown_table(diff.Existing, diff.Provider, diff.URL))
+			}
+		}
+	}
+	return markdown_out
+}
+
+// run_diff implements `moss diff old.json new.json`
+func run_diff(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := flags.String("format", "markdown", "Output Format, markdown or json")
+	outpath := flags.String("out", "", "Write the diff to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: moss diff [-format=markdown|json] [-out=path] old.json new.json")
+	}
+	old, err := load_json_output(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	cur, err := load_json_output(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	report := diff_results(old, cur)
+	var output string
+	switch strings.ToLower(*format) {
+	case "json":
+		output = diff_json_output(report)
+	case "markdown", "md":
+		output = diff_markdown_output(report)
+	default:
+		return fmt.Errorf("unknown diff format %q", *format)
+	}
+	if *outpath != "" {
+		log.Debug().Str("outpath", *outpath).Msg("writing diff output")
+		return os.WriteFile(*outpath, []byte(output), 0644)
+	}
+	_, err = io.WriteString(stdout, output)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffResults(t *testing.T) {
+	old_repo := getRepoResult()
+	fixed := old_repo.Results[0]
+	fixed.StartLine = 10
+	old_repo.Results = append(old_repo.Results, fixed)
+
+	new_repo := getRepoResult()
+	added := new_repo.Results[0]
+	added.Commit = "0123456789abcdef0123456789abcdef01234567"
+	new_repo.Results = append(new_repo.Results, added)
+	other := GitleaksRepoResult{Repository: "other", Org: "other_org", URL: "https://github.com/other_org/other"}
+
+	dir := t.TempDir()
+	old_path := filepath.Join(dir, "old.json")
+	new_path := filepath.Join(dir, "new.json")
+	os.WriteFile(old_path, []byte(json_output([]GitleaksRepoResult{old_repo}, []string{"org"})), 0644)
+	os.WriteFile(new_path, []byte(json_output([]GitleaksRepoResult{new_repo, other}, []string{"org", "other_org"})), 0644)
+
+	var out strings.Builder
+	if err := run_diff([]string{"-format=json", old_path, new_path}, &out); err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	var report diffReport
+	if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+		t.Fatalf("diff json didn't parse: %v", err)
+	}
+	if report.New != 1 || report.Fixed != 1 || report.Existing != 1 {
+		t.Errorf("wrong totals: %+v", report)
+	}
+	repos := report.Orgs["org"]
+	if len(repos) != 1 || repos[0].New[0].Commit != added.Commit || repos[0].Fixed[0].StartLine != 10 {
+		t.Errorf("wrong repo diff: %+v", repos)
+	}
+	if len(report.Orgs["other_org"]) != 0 {
+		t.Errorf("clean repos should be left out: %+v", report.Orgs["other_org"])
+	}
+
+	out.Reset()
+	if err := run_diff([]string{old_path, new_path}, &out); err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	for _, want := range []string{"1 new, 1 fixed, 1 still present", "## org\n", "#### New", "#### Fixed", "## other_org\nNo findings!"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("markdown diff is missing %q:\n%s", want, out.String())
+		}
+	}
+	if err := run_diff([]string{old_path}, &out); err == nil {
+		t.Errorf("diff needs two files")
+	}
+}
+
+func TestDiffSkipsIncompleteRepos(t *testing.T) {
+	old_repo := getRepoResult()
+	timed_out := GitleaksRepoResult{Repository: old_repo.Repository, Org: old_repo.Org, URL: old_repo.URL, TimedOut: true, Err: errors.New("scan timed out after 1h")}
+	failed := GitleaksRepoResult{Repository: old_repo.Repository, Org: old_repo.Org, URL: old_repo.URL, Err: errors.New("clone failed")}
+
+	dir := t.TempDir()
+	old_path := filepath.Join(dir, "old.json")
+	os.WriteFile(old_path, []byte(json_output([]GitleaksRepoResult{old_repo}, []string{"org"})), 0644)
+	for _, cur := range []GitleaksRepoResult{timed_out, failed} {
+		new_path := filepath.Join(dir, "new.json")
+		os.WriteFile(new_path, []byte(json_output([]GitleaksRepoResult{cur}, []string{"org"})), 0644)
+		old, _ := load_json_output(old_path)
+		now, _ := load_json_output(new_path)
+		report := diff_results(old, now)
+		if report.Fixed != 0 || report.New != 0 || report.NotCompared != 1 {
+			t.Errorf("an unfinished scan shouldn't fix findings, got %+v", report)
+		}
+		if repos := report.Orgs["org"]; len(repos) != 1 || !strings.Contains(repos[0].NotCompared, "new run") {
+			t.Errorf("the repo should be listed as not compared, got %+v", repos)
+		}
+		if md := diff_markdown_output(report); !strings.Contains(md, "1 repos not compared") || !strings.Contains(md, "Not compared, the scan") {
+			t.Errorf("markdown doesn't mention the repo that wasn't compared:\n%s", md)
+		}
+	}
+}
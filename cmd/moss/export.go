@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// output_formats are the supported -format values
+var output_formats = []string{"markdown", "json", "html", "sarif", "csv", "jsonl"}
+
+// parse_formats splits a comma separated list of formats, dropping
+// duplicates. The flag takes precedence over the config.
+func parse_formats(flag_formats string, conf_format string) ([]string, error) {
+	list := flag_formats
+	if list == "" {
+		list = conf_format
+	}
+	formats := make([]string, 0)
+	for _, format := range strings.Split(strings.ToLower(list), ",") {
+		format = strings.TrimSpace(format)
+		if format == "" || contains(formats, format) {
+			continue
+		}
+		if !contains(output_formats, format) {
+			return nil, fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(output_formats, ", "))
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no output format set")
+	}
+	return formats, nil
+}
+
+// record types in jsonl output, and in the type column of csv output
+const (
+	flat_finding       = "finding"
+	flat_suppressed    = "suppressed"
+	flat_unique_secret = "unique_secret"
+)
+
+// flatFinding is a finding with its repo, one per csv row or jsonl line
+type flatFinding struct {
+	// Type is finding for reported findings or suppressed
+	Type        string `json:"type"`
+	Org         string `json:"org"`
+	Repository  string `json:"repository"`
+	URL         string `json:"url"`
+	Private     bool   `json:"private"`
+	RuleID      string `json:"rule_id"`
+	Description string `json:"description"`
+	File        string `json:"file"`
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+	Commit      string `json:"commit"`
+	Author      string `json:"author"`
+	Email       string `json:"email"`
+	Date        string `json:"date"`
+	Fingerprint string `json:"fingerprint"`
+	// Secret is redacted like every other output
+	Secret        string `json:"secret"`
+	SecretHash    string `json:"secret_hash,omitempty"`
+	BaselineState string `json:"baseline_state,omitempty"`
+	// only set on suppressed findings
+	SuppressionKind    string `json:"suppression_kind,omitempty"`
+	SuppressionReason  string `json:"suppression_reason,omitempty"`
+	SuppressionExpires string `json:"suppression_expires,omitempty"`
+}
+
+// new columns go at the end so csv consumers reading by position keep working
+var flat_header = []string{"org", "repository", "url", "private", "rule_id", "description", "file", "start_line", "end_line",
+	"commit", "author", "email", "date", "fingerprint", "secret", "secret_hash", "baseline_state",
+	"type", "suppression_kind", "suppression_reason", "suppression_expires"}
+
+func (f flatFinding) row() []string {
+	return []string{f.Org, f.Repository, f.URL, strconv.FormatBool(f.Private), f.RuleID, f.Description, f.File,
+		strconv.Itoa(f.StartLine), strconv.Itoa(f.EndLine), f.Commit, f.Author, f.Email, f.Date, f.Fingerprint,
+		f.Secret, f.SecretHash, f.BaselineState, f.Type, f.SuppressionKind, f.SuppressionReason, f.SuppressionExpires}
+}
+
+// flatten_findings lists every reported finding in org order, followed by
+// the suppressed findings
+func flatten_findings(results []GitleaksRepoResult, orgs []string) []flatFinding {
+	json_res := get_json_obj(results, orgs)
+	flat := make([]flatFinding, 0)
+	suppressed := make([]flatFinding, 0)
+	for _, org := range orgs {
+		for _, repo_result := range json_res[org] {
+			for _, finding := range repo_result.Suppressed {
+				f := flat_finding_of(org, repo_result, finding)
+				f.Type = flat_suppressed
+				if finding.Suppression != nil {
+					f.SuppressionKind = finding.Suppression.Kind
+					f.SuppressionReason = finding.Suppression.Reason
+					f.SuppressionExpires = finding.Suppression.Expires
+				}
+				suppressed = append(suppressed, f)
+			}
+			for _, finding := range repo_result.Results {
+				flat = append(flat, flat_finding_of(org, repo_result, finding))
+			}
+		}
+	}
+	return append(flat, suppressed...)
+}
+
+func flat_finding_of(org string, repo_result GitleaksRepoResult, finding GitleaksResult) flatFinding {
+	return flatFinding{
+		Type:          flat_finding,
+		Org:           org,
+		Repository:    repo_result.Repository,
+		URL:           repo_result.URL,
+		Private:       repo_result.IsPrivate,
+		RuleID:        finding.RuleID,
+		Description:   finding.Description,
+		File:          finding.File,
+		StartLine:     finding.StartLine,
+		EndLine:       finding.EndLine,
+		Commit:        finding.Commit,
+		Author:        finding.Author,
+		Email:         finding.Email,
+		Date:          finding.Date,
+		Fingerprint:   finding.fingerprint(repo_result.URL),
+		Secret:        finding.Secret,
+		SecretHash:    finding.SecretHash,
+		BaselineState: finding.BaselineState,
+	}
+}
+
+// flatUniqueSecret is a unique secret as a jsonl line or a row of
+// unique_secrets.csv
+type flatUniqueSecret struct {
+	Type           string           `json:"type"`
+	SecretHash     string           `json:"secret_hash"`
+	RuleIDs        []string         `json:"rule_ids"`
+	Repos          []string         `json:"repos"`
+	FirstSeen      string           `json:"first_seen"`
+	EarliestAuthor string           `json:"earliest_author"`
+	EarliestEmail  string           `json:"earliest_email"`
+	Locations      []SecretLocation `json:"locations"`
+}
+
+var unique_secrets_header = []string{"secret_hash", "rule_ids", "repos", "locations", "first_seen", "earliest_author", "earliest_email"}
+
+func flatten_unique_secret(u UniqueSecret) flatUniqueSecret {
+	return flatUniqueSecret{
+		Type:           flat_unique_secret,
+		SecretHash:     u.Hash,
+		RuleIDs:        u.RuleIDs,
+		Repos:          u.Repos,
+		FirstSeen:      u.FirstSeen,
+		EarliestAuthor: u.EarliestAuthor,
+		EarliestEmail:  u.EarliestEmail,
+		Locations:      u.Locations,
+	}
+}
+
+func (u flatUniqueSecret) row() []string {
+	return []string{u.SecretHash, strings.Join(u.RuleIDs, ";"), strings.Join(u.Repos, ";"), strconv.Itoa(len(u.Locations)),
+		u.FirstSeen, u.EarliestAuthor, u.EarliestEmail}
+}
+
+// csv_cell stops spreadsheets treating a cell as a formula. Authors, paths
+// and secrets come from the repos being scanned, so a value like
+// =HYPERLINK(...) is prefixed with ' to be shown as text.
+func csv_cell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csv_output renders one row per finding with a header row. Suppressed
+// findings come last with their type column set to suppressed.
+func csv_output(results []GitleaksRepoResult, orgs []string) string {
+	rows := make([][]string, 0)
+	for _, f := range flatten_findings(results, orgs) {
+		rows = append(rows, f.row())
+	}
+	return csv_table(flat_header, rows)
+}
+
+// unique_secrets_csv renders one row per unique secret, with the lists
+// joined by ;
+func unique_secrets_csv(unique []UniqueSecret) string {
+	rows := make([][]string, 0)
+	for _, u := range unique {
+		rows = append(rows, flatten_unique_secret(u).row())
+	}
+	return csv_table(unique_secrets_header, rows)
+}
+
+func csv_table(header []string, rows [][]string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	for _, row := range rows {
+		for i := range row {
+			row[i] = csv_cell(row[i])
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to write csv results")
+	}
+	return buf.String()
+}
+
+// jsonl_output renders one json object per line per finding, then one per
+// suppressed finding and one per unique secret, told apart by their type
+func jsonl_output(results []GitleaksRepoResult, orgs []string, extras reportExtras) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, f := range flatten_findings(results, orgs) {
+		if err := enc.Encode(f); err != nil {
+			log.Fatal().Err(err).Msg("Failed to marshal jsonl results")
+		}
+	}
+	for _, u := range extras.UniqueSecrets {
+		if err := enc.Encode(flatten_unique_secret(u)); err != nil {
+			log.Fatal().Err(err).Msg("Failed to marshal jsonl results")
+		}
+	}
+	return buf.String()
+}
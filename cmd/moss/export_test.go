@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	formats, err := parse_formats("JSON, csv,sarif,json", "markdown")
+	if err != nil || !reflect.DeepEqual(formats, []string{"json", "csv", "sarif"}) {
+		t.Errorf("got %v, %v", formats, err)
+	}
+	if formats, err := parse_formats("", "markdown"); err != nil || !reflect.DeepEqual(formats, []string{"markdown"}) {
+		t.Errorf("expected the config format, got %v, %v", formats, err)
+	}
+	if _, err := parse_formats("json,xml", ""); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := parse_formats("", ""); err == nil {
+		t.Error("expected an error without a format")
+	}
+}
+
+func TestCsvOutput(t *testing.T) {
+	repo := getRepoResult()
+	repo.Results[0].Description = "Generic, \"quoted\" key"
+	repo.Results[0].Author = "=HYPERLINK(\"https://example.com\")"
+	repo.Results[0].File = "@cmd|' /C calc'!A0"
+	rows, err := csv.NewReader(strings.NewReader(csv_output([]GitleaksRepoResult{repo}, []string{"org"}))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(rows[0], flat_header) {
+		t.Fatalf("expected a header and a row, got %v", rows)
+	}
+	want := map[string]string{
+		"org":         "org",
+		"repository":  "repo",
+		"private":     "true",
+		"description": "Generic, \"quoted\" key",
+		"start_line":  "63",
+		"end_line":    "64",
+		"fingerprint": repo.Results[0].fingerprint(repo.URL),
+		"author":      "'=HYPERLINK(\"https://example.com\")",
+		"file":        "'@cmd|' /C calc'!A0",
+	}
+	for i, column := range rows[0] {
+		if value, ok := want[column]; ok && rows[1][i] != value {
+			t.Errorf("%s: expected %q, got %q", column, value, rows[1][i])
+		}
+	}
+}
+
+func TestJsonlOutput(t *testing.T) {
+	other := getRepoResult()
+	other.Repository = "other"
+	out := jsonl_output([]GitleaksRepoResult{getRepoResult(), other}, []string{"org"}, reportExtras{})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per finding, got %d", len(lines))
+	}
+	var f flatFinding
+	if err := json.Unmarshal([]byte(lines[1]), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Repository != "other" || f.RuleID != "generic-api-key" || f.Commit == "" || f.Type != flat_finding {
+		t.Errorf("unexpected finding %+v", f)
+	}
+}
+
+func TestExportSuppressedAndUniqueSecrets(t *testing.T) {
+	repo := getRepoResult()
+	suppressed := repo.Results[0]
+	suppressed.File = "testdata/creds.json"
+	suppressed.Suppression = &Suppression{Kind: suppression_rule, Reason: "fixtures"}
+	repo.Suppressed = []GitleaksResult{suppressed}
+	unique := []UniqueSecret{{Hash: "abc", RuleIDs: []string{"generic-api-key"}, Repos: []string{"org/repo"},
+		Locations: []SecretLocation{{Org: "org", Repository: "repo"}}, FirstSeen: "2023-01-02T03:04:05Z"}}
+
+	lines := strings.Split(strings.TrimSpace(jsonl_output([]GitleaksRepoResult{repo}, []string{"org"}, reportExtras{UniqueSecrets: unique})), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a finding, a suppressed finding and a unique secret, got %d lines", len(lines))
+	}
+	var f flatFinding
+	if err := json.Unmarshal([]byte(lines[1]), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != flat_suppressed || f.File != suppressed.File || f.SuppressionKind != suppression_rule || f.SuppressionReason != "fixtures" {
+		t.Errorf("unexpected suppressed finding %+v", f)
+	}
+	var u flatUniqueSecret
+	if err := json.Unmarshal([]byte(lines[2]), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Type != flat_unique_secret || u.SecretHash != "abc" || len(u.Locations) != 1 {
+		t.Errorf("unexpected unique secret %+v", u)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(csv_output([]GitleaksRepoResult{repo}, []string{"org"}))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][17] != flat_finding || rows[2][17] != flat_suppressed || rows[2][19] != "fixtures" {
+		t.Errorf("suppressed findings should be rows with their type set, got %v", rows)
+	}
+
+	dir := t.TempDir()
+	write_outputs([]string{"csv"}, dir, []GitleaksRepoResult{repo}, []string{"org"}, reportExtras{UniqueSecrets: unique}, "")
+	out, err := os.ReadFile(filepath.Join(dir, "unique_secrets.csv"))
+	if err != nil {
+		t.Fatalf("unique_secrets.csv wasn't written: %v", err)
+	}
+	rows, err = csv.NewReader(strings.NewReader(string(out))).ReadAll()
+	if err != nil || len(rows) != 2 || !reflect.DeepEqual(rows[1], []string{"abc", "generic-api-key", "org/repo", "1", "2023-01-02T03:04:05Z", "", ""}) {
+		t.Errorf("unexpected unique secrets csv %v %v", rows, err)
+	}
+}
+
+func TestWriteOutputsMultipleFormats(t *testing.T) {
+	dir := t.TempDir()
+	write_outputs([]string{"json", "csv", "jsonl", "markdown"}, dir, []GitleaksRepoResult{getRepoResult()}, []string{"org"}, reportExtras{}, "")
+	for _, name := range []string{"output.json", "output.csv", "output.jsonl", "output.md"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Size() == 0 {
+			t.Errorf("%s wasn't written: %v", name, err)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 func (r *GitleaksRepoResult) filterResults(conf Conf) {
+	// move findings suppressed by allow comments to the suppressed list
+	r.filterSuppressed(time.Now())
+
 	// filter out explicitly ignored secrets
 	no_ignored := make([]GitleaksResult, 0)
 	for _, r := range r.Results {
@@ -69,4 +75,11 @@ func (r *GitleaksRepoResult) filterResults(conf Conf) {
 	}
 	r.Results = no_ignored
 
+	// move findings matching a suppression rule to the suppressed list
+	r.filterRules(conf.suppression_rules)
+
+	// filter out findings triaged as false positives or accepted risks
+	r.filterTriaged(conf.findings)
+
+	r.hashSecrets(conf.secret_salt)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const gitea_cloud_url = "https://gitea.com"
+const gitea_page_size = 50
+
+// Gitea/Forgejo repository, see /api/v1/orgs/{org}/repos
+type giteaRepo struct {
+	Name      string    `json:"name"`
+	FullName  string    `json:"full_name"`
+	CloneURL  string    `json:"clone_url"`
+	HTMLURL   string    `json:"html_url"`
+	Private   bool      `json:"private"`
+	Archived  bool      `json:"archived"`
+	Empty     bool      `json:"empty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Convert Gitea to common Git Repo Struct
+func gitea_to_git(repo giteaRepo, pat string, org OrgConfig) *GitRepo {
+	return &GitRepo{
+		Name:     repo.Name,
+		FullName: repo.FullName,
+		CloneURL: repo.CloneURL,
+		HTMLURL:  repo.HTMLURL,
+		Private:  repo.Private,
+		orgname:  org.Name,
+		Archived: repo.Archived,
+		PushedAt: repo.UpdatedAt,
+		pat:      pat,
+		scanner:  org.Scanner,
+		provider: "GITEA",
+	}
+}
+
+// gitea_api_url returns the API root for an org. Gitea and Forgejo are
+// usually self hosted, "cloud" orgs default to gitea.com
+func gitea_api_url(org OrgConfig) (string, error) {
+	base := org.BaseURL
+	if org.Type == "onprem" && base == "" {
+		return "", fmt.Errorf("Gitea on-prem org '%s' requires base_url", org.Name)
+	}
+	if base == "" {
+		base = gitea_cloud_url
+	}
+	return fmt.Sprintf("%s/api/v1", strings.TrimSuffix(base, "/")), nil
+}
+
+// get_gitea_org_repos lists the repositories of a Gitea/Forgejo organization.
+// The org repo listing can't be sorted, so every page is read and repos are
+// filtered on their last update.
+func get_gitea_org_repos(ctx context.Context, org OrgConfig, pat string, daysago int, skipRepos []string) ([]*GitRepo, error) {
+	api, err := gitea_api_url(org)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Authorization": "token " + pat}
+	time_ago := time.Now().AddDate(0, 0, (-1 * daysago))
+	repos := make([]*GitRepo, 0)
+	for page := 1; ; page++ {
+		page_url := fmt.Sprintf("%s/orgs/%s/repos?limit=%d&page=%d", api, url.PathEscape(org.Name), gitea_page_size, page)
+		var page_repos []giteaRepo
+		if _, err := get_json(ctx, page_url, headers, &page_repos); err != nil {
+			return nil, err
+		}
+		for _, repo := range page_repos {
+			if repo.Archived {
+				log.Debug().Str("repo", repo.FullName).Msg("skipping repo because it's archived")
+				continue
+			}
+			if repo.Empty {
+				log.Debug().Str("repo", repo.FullName).Msg("skipping repo because it's empty")
+				continue
+			}
+			if contains(skipRepos, repo.FullName) {
+				log.Debug().Str("repo", repo.FullName).Msg("skipping repo due to config")
+				continue
+			}
+			if daysago > 0 && repo.UpdatedAt.Before(time_ago) {
+				continue
+			}
+			repos = append(repos, gitea_to_git(repo, pat, org))
+		}
+		// servers may cap the page size below what we asked for, so only
+		// an empty page reliably marks the end
+		if len(page_repos) == 0 {
+			break
+		}
+	}
+	return repos, nil
+}
+
+func get_all_gitea_repos(ctx context.Context, orgs []OrgConfig, conf Conf) map[string]*GitRepo {
+	gitea_repos := make(map[string]*GitRepo)
+	for _, org := range orgs {
+		pat := getPat("GITEA", org)
+		if pat == "" {
+			continue
+		}
+		repos, err := get_gitea_org_repos(ctx, org, pat, conf.GiteaConfig.DaysToScan, conf.SkipRepos)
+		if err != nil {
+			log.Error().Err(err).Str("org", org.Name).Msg("Failed to get repos from Gitea. Continuing")
+			continue
+		}
+		log.Info().Str("org", org.Name).Str("type", org.Type).Int("repos", len(repos)).Msg("enumerated Gitea repos")
+		for _, repo := range repos {
+			gitea_repos[repo.HTMLURL] = repo
+		}
+	}
+	return gitea_repos
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newGiteaServer stands in for a Gitea/Forgejo instance serving two pages
+// of repos for the org "team"
+func newGiteaServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/orgs/team/repos" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "token gitea-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		repo := func(name string, updated time.Time, archived bool) giteaRepo {
+			return giteaRepo{
+				Name:      name,
+				FullName:  "team/" + name,
+				CloneURL:  "https://git.example.com/team/" + name + ".git",
+				HTMLURL:   "https://git.example.com/team/" + name,
+				Private:   true,
+				Archived:  archived,
+				UpdatedAt: updated,
+			}
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		repos := []giteaRepo{}
+		switch page {
+		case 1:
+			repos = append(repos, repo("fresh", time.Now(), false), repo("archived", time.Now(), true), repo("skipme", time.Now(), false))
+		case 2:
+			repos = append(repos, repo("old", time.Now().AddDate(0, -2, 0), false), repo("recent", time.Now().AddDate(0, 0, -1), false))
+		}
+		json.NewEncoder(w).Encode(repos)
+	}))
+}
+
+func TestGiteaOrgRepos(t *testing.T) {
+	srv := newGiteaServer()
+	defer srv.Close()
+
+	org := OrgConfig{Name: "team", Type: "onprem", BaseURL: srv.URL}
+	repos, err := get_gitea_org_repos(context.Background(), org, "gitea-token", 30, []string{"team/skipme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("wanted 2 repos, got %d", len(repos))
+	}
+	if repos[0].Name != "fresh" || repos[1].Name != "recent" {
+		t.Errorf("wrong repos returned: %s, %s", repos[0].Name, repos[1].Name)
+	}
+	if repos[0].provider != "GITEA" || repos[0].orgname != "team" || repos[0].pat != "gitea-token" {
+		t.Errorf("repo converted wrong: %+v", repos[0])
+	}
+	// days_to_scan <= 0 scans everything that isn't archived or skipped
+	repos, err = get_gitea_org_repos(context.Background(), org, "gitea-token", 0, []string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repos) != 4 {
+		t.Errorf("wanted 4 repos, got %d", len(repos))
+	}
+}
+
+func TestGetAllGiteaRepos(t *testing.T) {
+	srv := newGiteaServer()
+	defer srv.Close()
+
+	t.Setenv("GITEA_PAT_team", "gitea-token")
+	conf := Conf{GiteaConfig: ConfGiteaConfig{
+		OrgsToScan: []OrgConfig{
+			{Name: "team", Type: "onprem", BaseURL: srv.URL},
+			{Name: "nobaseurl", Type: "onprem"},
+		},
+		DaysToScan: 30,
+	}}
+	t.Setenv("GITEA_PAT_nobaseurl", "gitea-token")
+	repos := get_all_gitea_repos(context.Background(), conf.GiteaConfig.OrgsToScan, conf)
+	if len(repos) != 3 {
+		t.Errorf("wanted 3 repos, got %d", len(repos))
+	}
+	if _, ok := repos["https://git.example.com/team/fresh"]; !ok {
+		t.Errorf("repos should be keyed by html url")
+	}
+}
@@ -24,6 +24,7 @@ func github_to_git(project *github.Repository, pat string, org OrgConfig) *GitRe
 		Archived: project.GetArchived(),
 		PushedAt: project.GetPushedAt().Time,
 		pat:      pat,
+		scanner:  org.Scanner,
 		provider: "GITHUB",
 	}
 }
@@ -56,7 +57,7 @@ func InitGitHubClient(org OrgConfig, token string) (*github.Client, error) {
 	return github.NewClient(tc), nil
 }
 
-func get_all_github_repos(orgs []OrgConfig, conf Conf) map[string]*GitRepo {
+func get_all_github_repos(ctx context.Context, orgs []OrgConfig, conf Conf) map[string]*GitRepo {
 	all_repos := make(map[string]*GitRepo, 0)
 
 	for _, org := range orgs {
@@ -67,7 +68,7 @@ func get_all_github_repos(orgs []OrgConfig, conf Conf) map[string]*GitRepo {
 			continue
 		}
 		log.Info().Str("org", org.Name).Str("type", org.Type).Msg("connected to GitHub")
-		repos, err := get_org_repos(org, client, conf.GithubConfig.DaysToScan, conf.SkipRepos)
+		repos, err := get_org_repos(ctx, org, client, conf.GithubConfig.DaysToScan, conf.SkipRepos)
 
 		if err != nil {
 			log.Error().Err(err).Str("org", org.Name).Msg("Failed to get repos from org. Continuing")
@@ -82,13 +83,18 @@ func get_all_github_repos(orgs []OrgConfig, conf Conf) map[string]*GitRepo {
 }
 
 // Get github repos for the respective ORGs
-func get_org_repos(org OrgConfig, client *github.Client, daysago int, skipRepos []string) ([]*github.Repository, error) {
+func get_org_repos(ctx context.Context, org OrgConfig, client *github.Client, daysago int, skipRepos []string) ([]*github.Repository, error) {
 	time_ago := time.Now().AddDate(0, 0, (-1 * daysago))
 	org_repos := make([]*github.Repository, 0)
 	page := 1
 	for {
 		opt := &github.RepositoryListByOrgOptions{Type: "all", Sort: "pushed", Direction: "desc", ListOptions: github.ListOptions{Page: page}}
-		repos, _, err := client.Repositories.ListByOrg(context.Background(), org.Name, opt)
+		var repos []*github.Repository
+		_, err := api_retry.do(ctx, "list repos for "+org.Name, func() error {
+			var err error
+			repos, _, err = client.Repositories.ListByOrg(ctx, org.Name, opt)
+			return err
+		})
 		if err != nil {
 			log.Error().Err(err).Str("org", org.Name).Msg("Error getting repositories from Github")
 			return nil, err
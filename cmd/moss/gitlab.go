@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -20,6 +21,10 @@ func contains(arr []string, s string) bool {
 
 // Convert Gitlab to common Git Repo Struct
 func gitlab_to_git(p *gitlab.Project, pat, org string) *GitRepo {
+	last_activity := time.Time{}
+	if p.LastActivityAt != nil {
+		last_activity = *p.LastActivityAt
+	}
 	return &GitRepo{
 		Name:     p.Name,
 		FullName: p.PathWithNamespace,
@@ -27,7 +32,7 @@ func gitlab_to_git(p *gitlab.Project, pat, org string) *GitRepo {
 		HTMLURL:  p.WebURL,
 		Private:  p.Visibility == "private",
 		Archived: p.Archived,
-		PushedAt: *p.LastActivityAt,
+		PushedAt: last_activity,
 		pat:      pat,
 		orgname:  org,
 		provider: "GITLAB",
@@ -38,53 +43,97 @@ func InitGitLabClient(org OrgConfig, token string) (*gitlab.Client, error) {
 	if token == "" {
 		return nil, fmt.Errorf("GitLab token missing for org: %s", org.Name)
 	}
+	// the client's own retries are off so api_retry is the only policy
 	if org.Type == "onprem" {
 		if org.BaseURL == "" {
 			return nil, fmt.Errorf("GitLab on-prem org '%s' requires base_url", org.Name)
 		}
-		return gitlab.NewClient(token, gitlab.WithBaseURL(org.BaseURL))
+		return gitlab.NewClient(token, gitlab.WithBaseURL(org.BaseURL), gitlab.WithoutRetries())
+	}
+	return gitlab.NewClient(token, gitlab.WithoutRetries())
+}
+
+// gitlab_group returns the full path of the group an org scans
+func gitlab_group(org OrgConfig) string {
+	if org.Group != "" {
+		return org.Group
+	}
+	return org.Name
+}
+
+// get_gitlab_group_projects lists the projects in the org's group, newest
+// activity first, stopping once projects are older than daysago
+func get_gitlab_group_projects(ctx context.Context, git *gitlab.Client, org OrgConfig, daysago int) ([]*gitlab.Project, error) {
+	time_ago := time.Now().AddDate(0, 0, (-1 * daysago))
+	include_subgroups := org.IncludeSubgroups == nil || *org.IncludeSubgroups
+	const perPage = 100
+	all_projects := make([]*gitlab.Project, 0)
+	for page := 1; ; page++ {
+		opt := &gitlab.ListGroupProjectsOptions{
+			Archived:         gitlab.Bool(false),
+			IncludeSubGroups: gitlab.Bool(include_subgroups),
+			WithShared:       gitlab.Bool(org.IncludeShared),
+			OrderBy:          gitlab.String("last_activity_at"),
+			Sort:             gitlab.String("desc"),
+			ListOptions: gitlab.ListOptions{
+				PerPage: perPage,
+				Page:    page,
+			},
+		}
+		var projects []*gitlab.Project
+		var resp *gitlab.Response
+		_, err := api_retry.do(ctx, "list projects for "+org.Name, func() error {
+			var err error
+			projects, resp, err = git.Groups.ListGroupProjects(gitlab_group(org), opt, gitlab.WithContext(ctx))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		saw_older := false
+		for _, project := range projects {
+			if daysago > 0 && project.LastActivityAt != nil && project.LastActivityAt.Before(time_ago) {
+				saw_older = true
+				break
+			}
+			all_projects = append(all_projects, project)
+		}
+		if saw_older || resp.NextPage == 0 {
+			break
+		}
 	}
-	return gitlab.NewClient(token)
+	return all_projects, nil
 }
 
-func get_all_gitlab_repos(orgs []OrgConfig, conf Conf) map[string]*GitRepo {
+func get_all_gitlab_repos(ctx context.Context, orgs []OrgConfig, conf Conf) map[string]*GitRepo {
 	gitlab_repos := make(map[string]*GitRepo)
-	time_ago := time.Now().AddDate(0, 0, (-1 * conf.GitlabConfig.DaysToScan))
 	for _, org := range orgs {
-		git, err := InitGitLabClient(org, getPat("GITLAB", org))
+		pat := getPat("GITLAB", org)
+		git, err := InitGitLabClient(org, pat)
 		if err != nil {
 			log.Error().Err(err).Str("org", org.Name).Msg("failed to connect to GitLab")
 			continue
 		}
-		log.Info().Str("org", org.Name).Str("type", org.Type).Msg("connected to GitLab")
-		const perPage = 100
-		var all_projects []*gitlab.Project
-		for page := 1; ; page++ {
-			opt := &gitlab.ListProjectsOptions{
-				LastActivityAfter: gitlab.Time(time_ago),
-				Membership:        gitlab.Bool(true),
-				Simple:            gitlab.Bool(true),
-				OrderBy:           gitlab.String("created_at"),
-				Sort:              gitlab.String("desc"),
-				ListOptions: gitlab.ListOptions{
-					PerPage: perPage,
-					Page:    page,
-				},
-			}
-			projects, resp, err := git.Projects.ListProjects(opt)
-			all_projects = append(all_projects, projects...)
-			if err != nil {
-				log.Error().Err(err).Str("org", org.Name).Msg("failed to get GitLab projects")
-				break
-			}
-			if resp.CurrentPage >= resp.TotalPages {
-				break
-			}
+		log.Info().Str("org", org.Name).Str("type", org.Type).Str("group", gitlab_group(org)).Msg("connected to GitLab")
+		projects, err := get_gitlab_group_projects(ctx, git, org, conf.GitlabConfig.DaysToScan)
+		if err != nil {
+			log.Error().Err(err).Str("org", org.Name).Msg("failed to get GitLab projects. Continuing")
+			continue
 		}
-		for _, project := range all_projects {
-			if !contains(conf.SkipRepos, project.PathWithNamespace) {
-				gitlab_repos[project.WebURL] = gitlab_to_git(project, getPat("GITLAB", org), org.Name)
+		for _, project := range projects {
+			if contains(conf.SkipRepos, project.PathWithNamespace) {
+				log.Debug().Str("repo", project.PathWithNamespace).Msg("skipping repo due to config")
+				continue
+			}
+			// a project shared into several configured groups is reported
+			// under the first org that found it
+			if existing, ok := gitlab_repos[project.WebURL]; ok {
+				log.Debug().Str("repo", project.PathWithNamespace).Str("org", existing.orgname).Msg("project already found in another org")
+				continue
 			}
+			repo := gitlab_to_git(project, pat, org.Name)
+			repo.scanner = org.Scanner
+			gitlab_repos[project.WebURL] = repo
 		}
 	}
 	return gitlab_repos
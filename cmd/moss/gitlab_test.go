@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGitlabGroupProjects(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/groups/parent%2Fteam/projects" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		project := func(name string, activity time.Time) map[string]interface{} {
+			return map[string]interface{}{
+				"name":                name,
+				"path_with_namespace": "parent/team/" + name,
+				"http_url_to_repo":    "https://gitlab.example.com/parent/team/" + name + ".git",
+				"web_url":             "https://gitlab.example.com/parent/team/" + name,
+				"visibility":          "private",
+				"last_activity_at":    activity.Format(time.RFC3339),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			json.NewEncoder(w).Encode([]interface{}{project("one", time.Now()), project("two", time.Now())})
+		} else {
+			json.NewEncoder(w).Encode([]interface{}{project("three", time.Now().AddDate(0, 0, -1)), project("stale", time.Now().AddDate(0, -6, 0))})
+		}
+	}))
+	defer srv.Close()
+
+	org := OrgConfig{Name: "team", Type: "onprem", BaseURL: srv.URL, Group: "parent/team"}
+	git, err := InitGitLabClient(org, "token")
+	if err != nil {
+		t.Fatalf("failed to init client: %v", err)
+	}
+	projects, err := get_gitlab_group_projects(context.Background(), git, org, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(projects) != 3 {
+		t.Fatalf("wanted 3 projects, got %d", len(projects))
+	}
+	if len(queries) != 2 {
+		t.Fatalf("wanted 2 pages to be requested, got %d", len(queries))
+	}
+	for _, q := range []string{"include_subgroups=true", "with_shared=false", "archived=false"} {
+		if !contains(strings.Split(queries[0], "&"), q) {
+			t.Errorf("query %q is missing %s", queries[0], q)
+		}
+	}
+	repo := gitlab_to_git(projects[0], "token", org.Name)
+	if repo.orgname != "team" || !repo.Private || repo.FullName != "parent/team/one" {
+		t.Errorf("project converted wrong: %+v", repo)
+	}
+}
+
+func TestGitlabGroup(t *testing.T) {
+	if gitlab_group(OrgConfig{Name: "org"}) != "org" {
+		t.Errorf("group should default to the org name")
+	}
+	if gitlab_group(OrgConfig{Name: "org", Group: "parent/org"}) != "parent/org" {
+		t.Errorf("group should override the org name")
+	}
+}
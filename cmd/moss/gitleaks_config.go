@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// GitleaksToml is the subset of the gitleaks.toml format MOSS understands
+type GitleaksToml struct {
+	Title     string            `toml:"title"`
+	Allowlist GitleaksAllowlist `toml:"allowlist"`
+	Rules     []GitleaksRule    `toml:"rules"`
+}
+
+type GitleaksRule struct {
+	ID          string            `toml:"id"`
+	Description string            `toml:"description"`
+	Regex       string            `toml:"regex"`
+	Path        string            `toml:"path"`
+	SecretGroup int               `toml:"secretGroup"`
+	Entropy     float64           `toml:"entropy"`
+	Keywords    []string          `toml:"keywords"`
+	Tags        []string          `toml:"tags"`
+	Allowlist   GitleaksAllowlist `toml:"allowlist"`
+}
+
+type GitleaksAllowlist struct {
+	Description string   `toml:"description"`
+	Regexes     []string `toml:"regexes"`
+	Paths       []string `toml:"paths"`
+	Commits     []string `toml:"commits"`
+	StopWords   []string `toml:"stopwords"`
+}
+
+// load_gitleaks_config reads and parses a gitleaks.toml file
+func load_gitleaks_config(path string) (*GitleaksToml, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse_gitleaks_config(string(contents))
+}
+
+// parse_gitleaks_config parses a gitleaks config, keys MOSS doesn't use
+// are ignored
+func parse_gitleaks_config(contents string) (*GitleaksToml, error) {
+	conf := &GitleaksToml{}
+	if _, err := toml.Decode(contents, conf); err != nil {
+		return nil, err
+	}
+	if conf.Rules == nil {
+		conf.Rules = make([]GitleaksRule, 0)
+	}
+	return conf, nil
+}
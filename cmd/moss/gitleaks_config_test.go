@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestLoadGitleaksConfig(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("failed to get current working directory")
+	}
+	gl_conf, err := load_gitleaks_config(fmt.Sprintf("%s/../../configs/gitleaks.toml", cwd))
+	if err != nil {
+		t.Fatalf("failed to parse gitleaks.toml: %v", err)
+	}
+	if !contains(gl_conf.Allowlist.Paths, "node_modules") || !contains(gl_conf.Allowlist.Paths, "(go.mod|go.sum)$") {
+		t.Errorf("global allowlist paths parsed wrong: %v", gl_conf.Allowlist.Paths)
+	}
+	var generic, aws *GitleaksRule
+	for i, rule := range gl_conf.Rules {
+		if rule.ID == "" || rule.Regex == "" {
+			t.Errorf("rule %d is missing an id or regex", i)
+		}
+		switch rule.ID {
+		case "generic-api-key":
+			generic = &gl_conf.Rules[i]
+		case "aws-access-token":
+			aws = &gl_conf.Rules[i]
+		}
+	}
+	if aws == nil {
+		t.Fatalf("aws-access-token rule not found")
+	}
+	if aws.Regex != "(A3T[A-Z0-9]|AKIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA|ASIA)[A-Z0-9]{16}" || aws.SecretGroup != 0 {
+		t.Errorf("aws-access-token regex/secretGroup parsed wrong: %q/%d", aws.Regex, aws.SecretGroup)
+	}
+	if len(aws.Keywords) != 8 || aws.Keywords[0] != "akia" || aws.Keywords[7] != "asia" {
+		t.Errorf("aws-access-token keywords parsed wrong: %v", aws.Keywords)
+	}
+	if generic == nil {
+		t.Fatalf("generic-api-key rule not found")
+	}
+	if generic.Entropy != 3.5 || generic.SecretGroup != 1 {
+		t.Errorf("generic-api-key entropy/secretGroup parsed wrong: %v/%d", generic.Entropy, generic.SecretGroup)
+	}
+	if len(generic.Keywords) != 9 {
+		t.Errorf("wanted 9 keywords, got %d", len(generic.Keywords))
+	}
+	if len(generic.Allowlist.StopWords) == 0 || generic.Allowlist.Paths[0] != "Database.refactorlog" {
+		t.Errorf("generic-api-key allowlist parsed wrong: %+v", generic.Allowlist)
+	}
+}
+
+func TestParseGitleaksConfigStrings(t *testing.T) {
+	toml := `
+title = "test"
+[[rules]]
+id = "basic"
+description = "escaped \"quote\" and \\ slash"
+regex = '''a[b]c'''
+tags = ['one', "two"] # trailing comment
+`
+	gl_conf, err := parse_gitleaks_config(toml)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	rule := gl_conf.Rules[0]
+	if rule.Description != `escaped "quote" and \ slash` {
+		t.Errorf("basic string parsed wrong: %q", rule.Description)
+	}
+	if rule.Regex != "a[b]c" {
+		t.Errorf("literal string parsed wrong: %q", rule.Regex)
+	}
+	if len(rule.Tags) != 2 || rule.Tags[1] != "two" {
+		t.Errorf("tags parsed wrong: %v", rule.Tags)
+	}
+}
+
+func TestParseGitleaksConfigErrors(t *testing.T) {
+	if _, err := parse_gitleaks_config("[[rules]]\nid = \"unterminated\n"); err == nil {
+		t.Error("expected an error for invalid toml")
+	}
+	// keys MOSS doesn't use, like newer gitleaks options, are ignored
+	gl_conf, err := parse_gitleaks_config("[extend]\nuseDefault = true\n[[rules]]\nid = \"x\"\nregex = \"x\"\n[rules.allowlist]\nregexTarget = \"match\"\nregexes = [\"y\"]\n")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if len(gl_conf.Rules) != 1 || gl_conf.Rules[0].Allowlist.Regexes[0] != "y" {
+		t.Errorf("rule parsed wrong: %+v", gl_conf.Rules)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+// html_report_template is the single-file HTML report. Everything (CSS and
+// JS) is inlined so the report can be opened offline or attached to a ticket
+// without pulling anything from a CDN.
+const html_report_template = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>MOSS Results</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+h1 { margin-bottom: 0.2em; }
+.generated { color: #57606a; font-size: 0.9em; }
+.summary { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.summary div { border: 1px solid #d0d7de; border-radius: 6px; padding: 0.8em 1.2em; min-width: 8em; }
+.summary .num { font-size: 1.6em; font-weight: 600; }
+.summary .label { color: #57606a; font-size: 0.85em; }
+details { margin: 0.5em 0; }
+details.org > summary { font-size: 1.3em; font-weight: 600; cursor: pointer; }
+details.repo { margin-left: 1.5em; }
+details.repo > summary { font-size: 1.05em; cursor: pointer; }
+.badge { display: inline-block; border-radius: 1em; padding: 0 0.6em; font-size: 0.8em; margin-left: 0.4em; background: #ddf4ff; }
+.badge.findings { background: #ffebe9; }
+.badge.private { background: #fff8c5; }
+.badge.error { background: #cf222e; color: #fff; }
+.clean { color: #1a7f37; margin-left: 1.5em; }
+.err { color: #cf222e; margin-left: 1.5em; }
+input.filter { margin: 0.5em 0; padding: 0.3em; width: 20em; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.5em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+code { font-family: SFMono-Regular, Consolas, monospace; }
+</style>
+</head>
+<body>
+<h1>MOSS Results</h1>
+<div class="generated">Generated {{.Generated}}</div>
+<div class="summary">
+  <div><div class="num">{{len .Orgs}}</div><div class="label">Organizations</div></div>
+  <div><div class="num">{{.TotalRepos}}</div><div class="label">Repositories scanned</div></div>
+  <div><div class="num">{{.ReposWithFindings}}</div><div class="label">Repositories with findings</div></div>
+  <div><div class="num">{{.TotalFindings}}</div><div class="label">Findings</div></div>
+  <div><div class="num">{{.Errors}}</div><div class="label">Scan errors</div></div>
+</div>
+{{range .Orgs}}
+<details class="org" open>
+  <summary>{{.Name}} <span class="badge findings">{{.Findings}} findings</span> <span class="badge">{{len .Repos}} repos</span></summary>
+  {{if eq .Findings 0}}{{if not .Errors}}<p class="clean">No findings!</p>{{end}}{{end}}
+  {{range .Repos}}{{if or .Findings .Err}}
+  <details class="repo">
+    <summary><a href="{{.URL}}">{{.Name}}</a>{{if .Private}} <span class="badge private">private</span>{{end}}{{if .Err}} <span class="badge error">error</span>{{end}} <span class="badge findings">{{len .Findings}} findings</span></summary>
+    {{if .Err}}<p class="err">Scan error: {{.Err}}</p>{{end}}
+    {{if .Findings}}
+    <input class="filter" type="search" placeholder="Filter findings...">
+    <table class="findings">
+      <thead><tr><th>Rule</th><th>File</th><th>Lines</th><th>Secret</th><th>Commit</th><th>Author</th><th>Date</th></tr></thead>
+      <tbody>
+      {{range .Findings}}<tr>
+        <td title="{{.Description}}">{{.RuleID}}</td>
+        <td>{{if .FileURL}}<a href="{{.FileURL}}"><code>{{.File}}</code></a>{{else}}<code>{{.File}}</code>{{end}}{{if .Existing}} <span class="badge">existing</span>{{end}}</td>
+        <td data-sort="{{.StartLine}}">{{.StartLine}}-{{.EndLine}}</td>
+        <td><code>{{.Secret}}</code></td>
+        <td>{{if .CommitURL}}<a href="{{.CommitURL}}"><code>{{.ShortCommit}}</code></a>{{else}}<code>{{.ShortCommit}}</code>{{end}}</td>
+        <td title="{{.Email}}">{{.Author}}</td>
+        <td>{{.Date}}</td>
+      </tr>{{end}}
+      </tbody>
+    </table>
+    {{end}}
+  </details>
+  {{end}}{{end}}
+</details>
+{{end}}
+{{if .ExpiringIgnores}}
+<details class="org" open>
+  <summary>Expiring ignores <span class="badge">{{len .ExpiringIgnores}} entries</span></summary>
+  <table class="findings">
+    <thead><tr><th>List</th><th>Repository</th><th>Value</th><th>Owner</th><th>Reason</th><th>Expires</th><th>State</th></tr></thead>
+    <tbody>
+    {{range .ExpiringIgnores}}<tr>
+      <td>{{.List}}</td>
+      <td>{{.Repo}}</td>
+      <td><code>{{.Value}}</code></td>
+      <td>{{.Owner}}</td>
+      <td>{{.Reason}}</td>
+      <td>{{.Expires}}</td>
+      <td data-sort="{{.DaysLeft}}">{{if .Expired}}<span class="badge error">expired</span>{{else}}expires in {{.DaysLeft}} days{{end}}</td>
+    </tr>{{end}}
+    </tbody>
+  </table>
+</details>
+{{end}}
+{{if .UniqueSecrets}}
+<details class="org">
+  <summary>Unique secrets <span class="badge">{{len .UniqueSecrets}} secrets</span></summary>
+  <table class="findings">
+    <thead><tr><th>Secret hash</th><th>Rules</th><th>Repos</th><th>Locations</th><th>First seen</th><th>Earliest author</th></tr></thead>
+    <tbody>
+    {{range .UniqueSecrets}}<tr>
+      <td><code title="{{.Hash}}">{{.ShortHash}}</code></td>
+      <td>{{.RuleIDs}}</td>
+      <td>{{.Repos}}</td>
+      <td>{{range .Locations}}<div>{{.Name}}: {{if .FileURL}}<a href="{{.FileURL}}"><code>{{.File}}:{{.StartLine}}</code></a>{{else}}<code>{{.File}}:{{.StartLine}}</code>{{end}} @ {{if .CommitURL}}<a href="{{.CommitURL}}"><code>{{.ShortCommit}}</code></a>{{else}}<code>{{.ShortCommit}}</code>{{end}}</div>{{end}}</td>
+      <td>{{.FirstSeen}}</td>
+      <td>{{.EarliestAuthor}}</td>
+    </tr>{{end}}
+    </tbody>
+  </table>
+</details>
+{{end}}
+{{if .Suppressed}}
+<details class="org">
+  <summary>Suppressed <span class="badge">{{len .Suppressed}} findings</span></summary>
+  <input class="filter" type="search" placeholder="Filter suppressed findings...">
+  <table class="findings">
+    <thead><tr><th>Repository</th><th>File</th><th>Rule</th><th>Kind</th><th>Reason</th><th>Expires</th><th>Commit</th></tr></thead>
+    <tbody>
+    {{range .Suppressed}}<tr>
+      <td><a href="{{.RepoURL}}">{{.Org}}/{{.Repository}}</a></td>
+      <td>{{if .FileURL}}<a href="{{.FileURL}}"><code>{{.File}}</code></a>{{else}}<code>{{.File}}</code>{{end}}</td>
+      <td>{{.RuleID}}</td>
+      <td>{{.Kind}}</td>
+      <td>{{.Reason}}</td>
+      <td>{{.Expires}}</td>
+      <td>{{if .CommitURL}}<a href="{{.CommitURL}}"><code>{{.ShortCommit}}</code></a>{{else}}<code>{{.ShortCommit}}</code>{{end}}</td>
+    </tr>{{end}}
+    </tbody>
+  </table>
+</details>
+{{end}}
+<script>
+(function () {
+  document.querySelectorAll("input.filter").forEach(function (input) {
+    var table = input.nextElementSibling;
+    input.addEventListener("input", function () {
+      var needle = input.value.toLowerCase();
+      table.querySelectorAll("tbody tr").forEach(function (row) {
+        row.style.display = row.textContent.toLowerCase().indexOf(needle) === -1 ? "none" : "";
+      });
+    });
+  });
+  document.querySelectorAll("table.findings").forEach(function (table) {
+    var headers = table.querySelectorAll("th");
+    headers.forEach(function (th, idx) {
+      th.addEventListener("click", function () {
+        var asc = !th.classList.contains("asc");
+        headers.forEach(function (h) { h.classList.remove("asc", "desc"); });
+        th.classList.add(asc ? "asc" : "desc");
+        var body = table.tBodies[0];
+        var rows = Array.prototype.slice.call(body.rows);
+        var key = function (row) {
+          var cell = row.cells[idx];
+          return cell.dataset.sort !== undefined ? cell.dataset.sort : cell.textContent.trim();
+        };
+        rows.sort(function (a, b) {
+          var x = key(a), y = key(b);
+          var nx = parseFloat(x), ny = parseFloat(y);
+          var cmp = (!isNaN(nx) && !isNaN(ny)) ? nx - ny : x.localeCompare(y);
+          return asc ? cmp : -cmp;
+        });
+        rows.forEach(function (row) { body.appendChild(row); });
+      });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`
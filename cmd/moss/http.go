@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// api_client is shared by the providers that talk to REST APIs directly
+// rather than through a client library
+var api_client = &http.Client{Timeout: 60 * time.Second}
+
+// apiError is a non 2xx response from an API
+type apiError struct {
+	StatusCode int
+	// RetryAfter is how long the server asked to wait, if it said
+	RetryAfter time.Duration
+	msg        string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+// get_json issues a GET against url with the given headers and decodes the
+// JSON body into out. Non 2xx responses are returned as errors. Transient
+// failures are retried following api_retry.
+func get_json(ctx context.Context, url string, headers map[string]string, out interface{}) (*http.Response, error) {
+	var resp *http.Response
+	_, err := api_retry.do(ctx, "GET "+url, func() error {
+		var err error
+		resp, err = get_json_once(ctx, url, headers, out)
+		return err
+	})
+	return resp, err
+}
+
+func get_json_once(ctx context.Context, url string, headers map[string]string, out interface{}) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := api_client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp, &apiError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: retry_after(resp),
+			msg:        fmt.Sprintf("GET %s returned %s: %s", resp.Request.URL.Path, resp.Status, string(body)),
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp, fmt.Errorf("failed to decode response from %s: %w", resp.Request.URL.Path, err)
+	}
+	return resp, nil
+}
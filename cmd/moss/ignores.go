@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const default_ignore_warning_days = 14
+
+// IgnoreEntry is an ignore list entry. In the config it's either a plain
+// string or an object with the value and who added it, why and until when.
+type IgnoreEntry struct {
+	Value   string `yaml:"value"`
+	Reason  string `yaml:"reason"`
+	Owner   string `yaml:"owner"`
+	Expires string `yaml:"expires"`
+}
+
+func (e *IgnoreEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*e = IgnoreEntry{Value: value}
+		return nil
+	}
+	type plain IgnoreEntry
+	if err := unmarshal((*plain)(e)); err != nil {
+		return err
+	}
+	if e.Value == "" {
+		return fmt.Errorf("ignore entry is missing a value")
+	}
+	if e.Expires != "" {
+		if _, err := time.Parse("2006-01-02", e.Expires); err != nil {
+			return fmt.Errorf("ignore entry %q has an invalid expires date, expected YYYY-MM-DD: %w", e.Value, err)
+		}
+	}
+	return nil
+}
+
+// annotatedIgnores is how the ignore lists are read from the config
+type annotatedIgnores struct {
+	IgnoreSecretPatterns []IgnoreEntry            `yaml:"ignore_secret_pattern"`
+	IgnoreSecrets        []IgnoreEntry            `yaml:"ignore_secrets"`
+	IgnoreCommits        []IgnoreEntry            `yaml:"ignore_commits"`
+	ReposToIgnore        map[string][]IgnoreEntry `yaml:"repo_ignore"`
+}
+
+// configIgnore is an ignore entry along with the list it came from
+type configIgnore struct {
+	List string
+	// Repo is set for repo_ignore entries
+	Repo string
+	IgnoreEntry
+}
+
+// UnmarshalYAML reads the config, turning the ignore lists into the plain
+// values filters work on. Expired entries are left out so they stop
+// applying, the full entries are kept for reporting on expiry.
+func (c *Conf) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Conf
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	var ignores annotatedIgnores
+	if err := unmarshal(&ignores); err != nil {
+		return err
+	}
+	now := time.Now()
+	c.ignore_entries = make([]configIgnore, 0)
+	active := func(list string, repo string, entries []IgnoreEntry) []string {
+		values := make([]string, 0)
+		for _, entry := range entries {
+			c.ignore_entries = append(c.ignore_entries, configIgnore{List: list, Repo: repo, IgnoreEntry: entry})
+			if suppression_expired(entry.Expires, now) {
+				continue
+			}
+			values = append(values, entry.Value)
+		}
+		return values
+	}
+	c.IgnoreSecretPatterns = active("ignore_secret_pattern", "", ignores.IgnoreSecretPatterns)
+	c.IgnoreSecrets = active("ignore_secrets", "", ignores.IgnoreSecrets)
+	c.IgnoreCommits = active("ignore_commits", "", ignores.IgnoreCommits)
+	c.ReposToIgnore = make(map[string][]string)
+	repos := make([]string, 0, len(ignores.ReposToIgnore))
+	for repo := range ignores.ReposToIgnore {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		c.ReposToIgnore[repo] = active("repo_ignore", repo, ignores.ReposToIgnore[repo])
+	}
+	// suppression rules expire the same way, they're reported by name
+	for i, rule := range c.SuppressionRules {
+		name := rule.label(i)
+		if rule.Expires != "" {
+			if _, err := time.Parse("2006-01-02", rule.Expires); err != nil {
+				return fmt.Errorf("suppression rule %s has an invalid expires date, expected YYYY-MM-DD: %w", name, err)
+			}
+		}
+		c.ignore_entries = append(c.ignore_entries, configIgnore{
+			List:        "suppression_rules",
+			IgnoreEntry: IgnoreEntry{Value: name, Reason: rule.Reason, Owner: rule.Owner, Expires: rule.Expires},
+		})
+	}
+	return nil
+}
+
+// ExpiringIgnore is an ignore entry that has expired or is about to
+type ExpiringIgnore struct {
+	List    string
+	Repo    string
+	Value   string
+	Reason  string
+	Owner   string
+	Expires string
+	Expired bool
+	// DaysLeft is how many days the entry still applies, 0 once expired
+	DaysLeft int
+}
+
+// expiring_ignores returns the entries that have expired or expire within
+// ignore_expiry_warning_days of now
+func (c *Conf) expiring_ignores(now time.Time) []ExpiringIgnore {
+	warning_days := c.IgnoreExpiryWarningDays
+	if warning_days == 0 {
+		warning_days = default_ignore_warning_days
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	expiring := make([]ExpiringIgnore, 0)
+	for _, entry := range c.ignore_entries {
+		if entry.Expires == "" {
+			continue
+		}
+		expires, err := time.Parse("2006-01-02", entry.Expires)
+		if err != nil {
+			continue
+		}
+		days_left := int(expires.Sub(today).Hours()/24) + 1
+		expired := suppression_expired(entry.Expires, now)
+		if !expired && days_left > warning_days {
+			continue
+		}
+		if expired {
+			days_left = 0
+		}
+		expiring = append(expiring, ExpiringIgnore{
+			List:     entry.List,
+			Repo:     entry.Repo,
+			Value:    entry.Value,
+			Reason:   entry.Reason,
+			Owner:    entry.Owner,
+			Expires:  entry.Expires,
+			Expired:  expired,
+			DaysLeft: days_left,
+		})
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].Expires < expiring[j].Expires
+	})
+	return expiring
+}
+
+// warn_expiring_ignores logs every expired and soon to expire ignore entry
+func warn_expiring_ignores(expiring []ExpiringIgnore) {
+	for _, e := range expiring {
+		event := log.Warn().Str("list", e.List).Str("value", e.Value).Str("owner", e.Owner).Str("expires", e.Expires)
+		if e.Repo != "" {
+			event = event.Str("repo", e.Repo)
+		}
+		if e.Expired {
+			event.Msg("ignore entry has expired and no longer applies")
+		} else {
+			event.Int("days_left", e.DaysLeft).Msg("ignore entry expires soon")
+		}
+	}
+}
+
+// expiring_ignores_markdown is the report section for expiring ignores
+func expiring_ignores_markdown(expiring []ExpiringIgnore) string {
+	if len(expiring) == 0 {
+		return ""
+	}
+	rows := ""
+	for _, e := range expiring {
+		state := fmt.Sprintf("expires in %d days", e.DaysLeft)
+		if e.Expired {
+			state = "expired"
+		}
+		rows = fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s|\n", rows, e.List, e.Repo, e.Value, e.Owner, e.Reason, e.Expires, state)
+	}
+	return fmt.Sprintf("## Expiring Ignores\n|List|Repository|Value|Owner|Reason|Expires|State|\n|----|----------|-----|-----|------|-------|-----|\n%s\n", rows)
+}
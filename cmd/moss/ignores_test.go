@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestAnnotatedIgnores(t *testing.T) {
+	config := `
+ignore_secrets:
+  - 'plainsecret'
+  - value: 'FIXTURESECRET123456'
+    reason: docs example
+    owner: jane
+    expires: 2090-01-20
+  - value: 'oldsecret'
+    owner: bob
+    expires: 2089-12-01
+ignore_commits:
+  - value: 'c0a4e7c1208fb49c28b2979fe68985ddac696a6e'
+    expires: 2091-01-01
+ignore_secret_pattern:
+  - '^.*key_id:.*'
+repo_ignore:
+  some_org/some_repo:
+    - 'docs/.*'
+    - value: 'vendor/.*'
+      expires: 2090-01-01
+`
+	var conf Conf
+	if err := yaml.Unmarshal([]byte(config), &conf); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	// none of the entries have expired yet, so every value applies
+	if len(conf.IgnoreSecrets) != 3 || conf.IgnoreSecrets[0] != "plainsecret" || conf.IgnoreSecrets[1] != "FIXTURESECRET123456" {
+		t.Errorf("ignore secrets parsed wrong: %v", conf.IgnoreSecrets)
+	}
+	if conf.IgnoreCommits[0] != "c0a4e7c1208fb49c28b2979fe68985ddac696a6e" || conf.IgnoreSecretPatterns[0] != "^.*key_id:.*" {
+		t.Errorf("ignore lists parsed wrong: %v %v", conf.IgnoreCommits, conf.IgnoreSecretPatterns)
+	}
+	if len(conf.ReposToIgnore["some_org/some_repo"]) != 2 {
+		t.Errorf("repo ignores parsed wrong: %v", conf.ReposToIgnore)
+	}
+
+	now := time.Date(2090, 1, 10, 9, 0, 0, 0, time.UTC)
+	expiring := conf.expiring_ignores(now)
+	if len(expiring) != 3 {
+		t.Fatalf("expected oldsecret, vendor and the fixture to be expiring, got %+v", expiring)
+	}
+	if !expiring[0].Expired || expiring[0].Value != "oldsecret" || !expiring[1].Expired || expiring[1].Repo != "some_org/some_repo" {
+		t.Errorf("expired entries are wrong: %+v", expiring)
+	}
+	if expiring[2].Expired || expiring[2].DaysLeft != 11 || expiring[2].Owner != "jane" {
+		t.Errorf("soon to expire entry is wrong: %+v", expiring[2])
+	}
+	if err := conf.setup_redaction(redact_partial); err != nil {
+		t.Fatal(err)
+	}
+	expiring = conf.Output.redact_ignores(expiring, conf.secret_salt)
+	md := expiring_ignores_markdown(expiring)
+	if !strings.Contains(md, "## Expiring Ignores") || !strings.Contains(md, "|ignore_secrets||FIXT...|jane|docs example|2090-01-20|expires in 11 days|") {
+		t.Errorf("markdown section is wrong:\n%s", md)
+	}
+	var report struct {
+		ExpiringIgnores []ExpiringIgnore `json:"_expiring_ignores"`
+	}
+	if err := json.Unmarshal([]byte(json_report(nil, []string{"org"}, reportExtras{ExpiringIgnores: expiring})), &report); err != nil {
+		t.Fatalf("json output isn't valid: %v", err)
+	}
+	if len(report.ExpiringIgnores) != 3 || report.ExpiringIgnores[2].Value != "FIXT..." || report.ExpiringIgnores[2].Owner != "jane" {
+		t.Errorf("json should list the redacted expiring ignores, got %+v", report.ExpiringIgnores)
+	}
+	outpath := filepath.Join(t.TempDir(), "output.html")
+	if err := html_output([]GitleaksRepoResult{getRepoResult()}, []string{"org"}, reportExtras{ExpiringIgnores: expiring}, outpath); err != nil {
+		t.Fatalf("html output failed: %v", err)
+	}
+	html, _ := os.ReadFile(outpath)
+	if !strings.Contains(string(html), "Expiring ignores") || strings.Contains(string(html), "FIXTURESECRET123456") {
+		t.Errorf("html should list expiring ignores without the full secret")
+	}
+}
+
+func TestExpiredIgnoresStopApplying(t *testing.T) {
+	config := `
+ignore_secrets:
+  - value: 'DEADBEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEF'
+    expires: 2000-01-01
+`
+	var conf Conf
+	if err := yaml.Unmarshal([]byte(config), &conf); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	rr := getRepoResult()
+	rr.filterResults(conf)
+	if len(rr.Results) != 1 {
+		t.Errorf("expired ignore entries shouldn't filter anything")
+	}
+	if err := yaml.Unmarshal([]byte("ignore_commits:\n  - reason: no value\n"), &conf); err == nil {
+		t.Errorf("entries without a value should fail")
+	}
+	if err := yaml.Unmarshal([]byte("ignore_commits:\n  - value: abc\n    expires: next week\n"), &conf); err == nil {
+		t.Errorf("entries with a bad date should fail")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const suppression_inline = "inline"
+
+// inline_marker matches allow comments like
+//
+//	api_key = "..." // moss:allow expires=2025-12-31 test fixture
+//
+// gitleaks:allow is accepted too so existing markers keep working
+var inline_marker = regexp.MustCompile(`\b(?:moss|gitleaks):allow\b(.*)`)
+
+var inline_expires = regexp.MustCompile(`^expires=(\d{4}-\d{2}-\d{2})\s*`)
+
+// comment closers left behind the reason by block comment styles
+var inline_closers = []string{"*/", "-->", "%>", "}}", "#}"}
+
+// parse_inline_allow returns the suppression a source line carries, if any
+func parse_inline_allow(line string) (*Suppression, bool) {
+	m := inline_marker.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	rest := strings.TrimSpace(m[1])
+	s := &Suppression{Kind: suppression_inline}
+	if e := inline_expires.FindStringSubmatch(rest); e != nil {
+		s.Expires = e[1]
+		rest = rest[len(e[0]):]
+	}
+	for _, closer := range inline_closers {
+		rest = strings.TrimSpace(strings.TrimSuffix(rest, closer))
+	}
+	s.Reason = strings.TrimSpace(strings.TrimLeft(rest, ":-"))
+	return s, true
+}
+
+// suppression_expired reports whether an expiry date (YYYY-MM-DD) has passed.
+// The expiry day itself still counts, invalid dates never expire.
+func suppression_expired(expires string, now time.Time) bool {
+	if expires == "" {
+		return false
+	}
+	t, err := time.Parse("2006-01-02", expires)
+	if err != nil {
+		return false
+	}
+	return now.After(t.AddDate(0, 0, 1))
+}
+
+// git_blob_lines returns the lines of file at rev in the repo at dir
+func git_blob_lines(dir string, rev string, file string) ([]string, error) {
+	out, err := exec.Command("git", "-C", dir, "show", rev+":"+file).Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(out), "\n"), nil
+}
+
+// annotate_inline_suppressions marks findings whose line carries an allow
+// marker. The marker is looked for on the finding's lines in the commit it
+// was found in, and on any line still holding the secret at HEAD so markers
+// added after the fact work too.
+func annotate_inline_suppressions(dir string, findings []GitleaksResult) []GitleaksResult {
+	blobs := make(map[string][]string)
+	blob := func(rev string, file string) []string {
+		key := rev + ":" + file
+		if lines, ok := blobs[key]; ok {
+			return lines
+		}
+		lines, err := git_blob_lines(dir, rev, file)
+		if err != nil {
+			log.Debug().Err(err).Str("blob", key).Msg("failed to read blob for inline suppressions")
+		}
+		blobs[key] = lines
+		return lines
+	}
+	for i, finding := range findings {
+		findings[i].Suppression = nil
+		if finding.File == "" || finding.StartLine < 1 {
+			continue
+		}
+		if finding.Commit != "" {
+			lines := blob(finding.Commit, finding.File)
+			for n := finding.StartLine; n <= finding.EndLine || n == finding.StartLine; n++ {
+				if n > len(lines) {
+					break
+				}
+				if s, ok := parse_inline_allow(lines[n-1]); ok {
+					findings[i].Suppression = s
+					break
+				}
+			}
+		}
+		if findings[i].Suppression != nil {
+			continue
+		}
+		needle := finding.Secret
+		if needle == "" {
+			needle = finding.Match
+		}
+		if needle == "" {
+			continue
+		}
+		for _, line := range blob("HEAD", finding.File) {
+			if !strings.Contains(line, needle) {
+				continue
+			}
+			if s, ok := parse_inline_allow(line); ok {
+				findings[i].Suppression = s
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// filterSuppressed moves findings with a suppression that hasn't expired
+// out of the results and into the suppressed list
+func (r *GitleaksRepoResult) filterSuppressed(now time.Time) {
+	kept := make([]GitleaksResult, 0)
+	for _, result := range r.Results {
+		if result.Suppression == nil {
+			kept = append(kept, result)
+			continue
+		}
+		if suppression_expired(result.Suppression.Expires, now) {
+			log.Warn().Str("repo", r.Repository).Str("file", result.File).Str("expires", result.Suppression.Expires).
+				Msg("inline suppression has expired, reporting the finding")
+			result.Suppression = nil
+			kept = append(kept, result)
+			continue
+		}
+		r.Suppressed = append(r.Suppressed, result)
+	}
+	r.Results = kept
+}
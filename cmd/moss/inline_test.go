@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInlineAllow(t *testing.T) {
+	cases := []struct {
+		line    string
+		ok      bool
+		reason  string
+		expires string
+	}{
+		{`key = "abc" # moss:allow`, true, "", ""},
+		{`key = "abc" // gitleaks:allow`, true, "", ""},
+		{`key = "abc" // moss:allow: test fixture`, true, "test fixture", ""},
+		{`key = "abc" /* moss:allow expires=2030-01-02 parser test */`, true, "parser test", "2030-01-02"},
+		{`<!-- moss:allow docs example -->`, true, "docs example", ""},
+		{`key = "abc" # mossallow`, false, "", ""},
+	}
+	for _, c := range cases {
+		s, ok := parse_inline_allow(c.line)
+		if ok != c.ok {
+			t.Errorf("%q: expected ok=%v", c.line, c.ok)
+			continue
+		}
+		if ok && (s.Reason != c.reason || s.Expires != c.expires || s.Kind != suppression_inline) {
+			t.Errorf("%q: parsed %+v", c.line, s)
+		}
+	}
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	if suppression_expired("2030-01-02", now) || !suppression_expired("2030-01-01", now) || suppression_expired("", now) {
+		t.Errorf("expiry should include the expiry day")
+	}
+}
+
+func TestInlineSuppressions(t *testing.T) {
+	dir := gitRepoWithCommit(t)
+	commitFile(t, dir, "fixture.py", "token = 'tok_in_blob' # moss:allow test fixture\nother = 'tok_later'\nold = 'tok_expired' # moss:allow expires=2000-01-01 old\n")
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("rev-parse failed: %v", err)
+	}
+	commit := strings.TrimSpace(string(out))
+	// the marker for the second secret is only added in a later commit
+	commitFile(t, dir, "fixture.py", "token = 'tok_in_blob' # moss:allow test fixture\nother = 'tok_later' // moss:allow added later\nold = 'tok_expired' # moss:allow expires=2000-01-01 old\n")
+
+	findings := []GitleaksResult{
+		{File: "fixture.py", Commit: commit, StartLine: 1, EndLine: 1, Secret: "tok_in_blob"},
+		{File: "fixture.py", Commit: commit, StartLine: 2, EndLine: 2, Secret: "tok_later"},
+		{File: "fixture.py", Commit: commit, StartLine: 3, EndLine: 3, Secret: "tok_expired"},
+		{File: "README.md", Commit: commit, StartLine: 1, EndLine: 1, Secret: "hello"},
+	}
+	findings = annotate_inline_suppressions(dir, findings)
+	if findings[0].Suppression == nil || findings[0].Suppression.Reason != "test fixture" {
+		t.Errorf("marker in the commit blob wasn't found: %+v", findings[0])
+	}
+	if findings[1].Suppression == nil || findings[1].Suppression.Reason != "added later" {
+		t.Errorf("marker added at HEAD wasn't found: %+v", findings[1])
+	}
+	if findings[3].Suppression != nil {
+		t.Errorf("unmarked finding was suppressed: %+v", findings[3])
+	}
+
+	repo := getRepoResult()
+	repo.Results = findings
+	repo.filterResults(Conf{})
+	if len(repo.Results) != 2 || len(repo.Suppressed) != 2 {
+		t.Fatalf("expected 2 results and 2 suppressed, got %+v / %+v", repo.Results, repo.Suppressed)
+	}
+	if repo.Results[0].Secret != "tok_expired" {
+		t.Errorf("expired suppressions should be reported, got %+v", repo.Results)
+	}
+	md := markdown_output([]GitleaksRepoResult{repo}, []string{"org"})
+	if !strings.Contains(md, "## Suppressed") || !strings.Contains(md, "|inline|test fixture|") {
+		t.Errorf("markdown is missing the suppressed section:\n%s", md)
+	}
+	sarif := sarif_output([]GitleaksRepoResult{repo}, []string{"org"}, nil, reportExtras{})
+	if strings.Count(sarif, `"kind":"inSource"`) != 2 {
+		t.Errorf("sarif should mark suppressed results: %s", sarif)
+	}
+}
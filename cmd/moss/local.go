@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const default_local_org = "local"
+
+// local_org_name is the org local paths and plain git urls are reported under
+func local_org_name(c ConfLocalConfig) string {
+	if c.OrgName == "" {
+		return default_local_org
+	}
+	return c.OrgName
+}
+
+// is_git_dir reports whether path is a working tree or a bare repository
+func is_git_dir(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		return true
+	}
+	// bare and mirror clones keep HEAD and objects at the top level
+	_, head_err := os.Stat(filepath.Join(path, "HEAD"))
+	_, obj_err := os.Stat(filepath.Join(path, "objects"))
+	return head_err == nil && obj_err == nil
+}
+
+// with_paths is the local config scanning only the given paths, used for
+// -path. The rest of the config, like the scanner, still applies.
+func (c ConfLocalConfig) with_paths(paths []string) ConfLocalConfig {
+	c.Paths = paths
+	c.GitURLs = nil
+	return c
+}
+
+// local_url is the file:// url of a local repo. It identifies the repo in
+// results and state, there's no web UI to link to.
+func local_url(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// Convert a checked out repository to common Git Repo Struct. Local repos
+// are scanned in place and never cloned.
+func local_to_git(path string, org string) *GitRepo {
+	return &GitRepo{
+		Name:      filepath.Base(path),
+		FullName:  path,
+		HTMLURL:   local_url(path),
+		Private:   true,
+		orgname:   org,
+		provider:  "LOCAL",
+		localPath: path,
+	}
+}
+
+// Convert a plain git remote to common Git Repo Struct. There's no API to
+// ask, so the web url is a best guess from the remote.
+func git_url_to_git(remote string, org string) *GitRepo {
+	name := strings.TrimSuffix(filepath.Base(remote), ".git")
+	full_name := strings.TrimSuffix(remote, ".git")
+	html_url := full_name
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		u.User = nil
+		full_name = strings.TrimPrefix(strings.TrimSuffix(u.Host+u.Path, ".git"), "/")
+		if u.Scheme == "http" || u.Scheme == "https" {
+			html_url = strings.TrimSuffix(u.String(), ".git")
+		}
+	}
+	return &GitRepo{
+		Name:     name,
+		FullName: full_name,
+		CloneURL: remote,
+		HTMLURL:  html_url,
+		Private:  true,
+		orgname:  org,
+		provider: "GIT",
+	}
+}
+
+// get_local_repos builds repos from local paths and git urls, no provider
+// API is involved
+func get_local_repos(c ConfLocalConfig, skipRepos []string) map[string]*GitRepo {
+	local_repos := make(map[string]*GitRepo)
+	org := local_org_name(c)
+	for _, path := range c.Paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("failed to resolve local path, skipping")
+			continue
+		}
+		if !is_git_dir(abs) {
+			log.Error().Str("path", abs).Msg("local path is not a git repository, skipping")
+			continue
+		}
+		if contains(skipRepos, abs) {
+			log.Debug().Str("repo", abs).Msg("skipping repo due to config")
+			continue
+		}
+		repo := local_to_git(abs, org)
+		repo.scanner = c.Scanner
+		local_repos[abs] = repo
+	}
+	for _, remote := range c.GitURLs {
+		repo := git_url_to_git(remote, org)
+		repo.scanner = c.Scanner
+		if contains(skipRepos, repo.FullName) {
+			log.Debug().Str("repo", repo.FullName).Msg("skipping repo due to config")
+			continue
+		}
+		local_repos[repo.HTMLURL] = repo
+	}
+	return local_repos
+}
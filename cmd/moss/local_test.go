@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetLocalRepos(t *testing.T) {
+	root := t.TempDir()
+	repo_dir := filepath.Join(root, "checkout")
+	if err := exec.Command("git", "init", "-q", repo_dir).Run(); err != nil {
+		t.Fatalf("failed to init test repo: %v", err)
+	}
+	not_git := filepath.Join(root, "plain")
+	if err := os.Mkdir(not_git, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	c := ConfLocalConfig{
+		Paths:   []string{repo_dir, not_git},
+		GitURLs: []string{"https://git.example.com/mirrors/vendored.git", "ssh://git@gerrit.example.com:29418/project.git"},
+	}
+	repos := get_local_repos(c, []string{})
+	if len(repos) != 3 {
+		t.Fatalf("wanted 3 repos, got %d", len(repos))
+	}
+	local := repos[repo_dir]
+	if local == nil || local.localPath != repo_dir || local.provider != "LOCAL" || local.orgname != "local" || local.HTMLURL != "file://"+repo_dir {
+		t.Errorf("local repo converted wrong: %+v", local)
+	}
+	remote := repos["https://git.example.com/mirrors/vendored"]
+	if remote == nil || remote.Name != "vendored" || remote.CloneURL != "https://git.example.com/mirrors/vendored.git" {
+		t.Errorf("git url converted wrong: %+v", remote)
+	}
+	if remote != nil && (remote.localPath != "" || remote.FullName != "git.example.com/mirrors/vendored") {
+		t.Errorf("git url should be cloned, got %+v", remote)
+	}
+	// skip_repos uses the full name
+	repos = get_local_repos(c, []string{"git.example.com/mirrors/vendored", repo_dir})
+	if len(repos) != 1 {
+		t.Errorf("wanted 1 repo after skipping, got %d", len(repos))
+	}
+	// -path replaces the configured paths but keeps the scanner
+	c.Scanner = "trufflehog"
+	repos = get_local_repos(c.with_paths([]string{repo_dir}), []string{})
+	if len(repos) != 1 || repos[repo_dir] == nil || repos[repo_dir].scanner != "trufflehog" {
+		t.Errorf("-path should scan only its paths with the configured scanner, got %+v", repos)
+	}
+}
+
+func TestLocalOrgName(t *testing.T) {
+	if local_org_name(ConfLocalConfig{}) != "local" {
+		t.Errorf("default org name should be local")
+	}
+	if local_org_name(ConfLocalConfig{OrgName: "mirrors"}) != "mirrors" {
+		t.Errorf("org name should come from the config")
+	}
+}
@@ -1,16 +1,17 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/go-github/v47/github"
 	"github.com/rs/zerolog"
@@ -27,94 +28,147 @@ func check_gitleaks_conf(gitleaks_path string) error {
 	return nil
 }
 
-func scan_repo(repo *GitRepo, gl_conf_path string, additional_args []string, results chan GitleaksRepoResult, sem *semaphore.Weighted) {
-	//Semaphone logic for Max Concurrencies
-	ctx := context.Background()
-	if err := sem.Acquire(ctx, 1); err != nil {
-		// log.Printf("Failed to acquire semaphore: %v", err)
-		log.Fatal().Err(err).Msg("failed to lock a semaphore")
+// clone_repo clones the repo into dir, authenticating with the repo's PAT.
+// dir is emptied if the clone fails so it can be retried.
+func clone_repo(ctx context.Context, repo *GitRepo, dir string) error {
+	if err := run_git(ctx, repo, "clone", "--quiet", repo.CloneURL, dir); err != nil {
+		if entries, read_err := os.ReadDir(dir); read_err == nil {
+			for _, entry := range entries {
+				os.RemoveAll(filepath.Join(dir, entry.Name()))
+			}
+		}
+		return err
 	}
-	defer sem.Release(1)
+	return nil
+}
+
+// scan_repo scans a repo and sends its result. The result is only sent once
+// the repo's temp dir is gone, so none are left behind when main exits.
+func scan_repo(ctx context.Context, repo *GitRepo, gl_conf_path string, conf Conf, results chan GitleaksRepoResult, sem *semaphore.Weighted) {
+	results <- scan_repo_result(ctx, repo, gl_conf_path, conf, sem)
+}
+
+func scan_repo_result(ctx context.Context, repo *GitRepo, gl_conf_path string, conf Conf, sem *semaphore.Weighted) GitleaksRepoResult {
+	state_dir := conf.Incremental.StateDir
 	// build a result object
 	result := GitleaksRepoResult{
 		Repository: repo.Name,
 		URL:        repo.HTMLURL,
+		Provider:   repo.provider,
+		Scanner:    strings.ToLower(scanner_name(repo, conf)),
 		IsPrivate:  repo.Private,
 		Org:        repo.orgname,
 	}
+	//Semaphone logic for Max Concurrencies
+	if err := sem.Acquire(ctx, 1); err != nil {
+		// the run was canceled before this repo got a turn
+		result.interrupted(ctx, "scan", 0)
+		return result
+	}
+	defer sem.Release(1)
 	// make temp dir
 	dir, err := os.MkdirTemp(os.TempDir(), "moss_")
 	if err != nil {
-		log.Error().Err(err).Str("repo", repo.Name).Msg("failed to create temp dir to scan repo")
-		result.Err = err
-		results <- result
-		return
+		log.Error().Err(scrub_error(err, repo)).Str("repo", repo.Name).Msg("failed to create temp dir to scan repo")
+		result.Err = scrub_error(err, repo)
+		return result
 	}
 	log.Debug().Str("repo", repo.Name).Str("dir", dir).Msg("tempdir set")
+	temp_dirs.Store(dir, true)
+	defer temp_dirs.Delete(dir)
 	defer os.RemoveAll(dir)
-	// clone into it
-	cloneUrl := repo.CloneURL
-	if repo.provider == "GITHUB" {
-		cloneUrl = strings.Replace(cloneUrl, "https://", fmt.Sprintf("https://%s@", repo.pat), 1)
-	} else if repo.provider == "GITLAB" {
-		cloneUrl = strings.Replace(cloneUrl, "https://", fmt.Sprintf("https://oauth2:%s@", repo.pat), 1)
-	}
-	cloneargs := []string{"clone", cloneUrl, dir}
-	cmd := exec.Command("git", cloneargs...)
-	if err := cmd.Run(); err != nil {
-		log.Error().Err(err).Str("repo", repo.Name).Msg("failed to clone repo")
-		result.Err = err
-		results <- result
-		return
-	}
-	// run gitleaks
-	outputpath := fmt.Sprintf("%s/__gitleaks.json", dir)
-	outputarg := fmt.Sprintf("-r=%s", outputpath)
-	confpath := fmt.Sprintf("-c=%s", gl_conf_path)
-	// not exactly sure why gitleaks doesn't detect that
-	// it IS a git repo, but we can still detect secrets
-	dirarg := fmt.Sprintf("-s=%s", dir)
-	gitleaks_args := []string{"detect", "-v", "-f=json", "--exit-code=0", outputarg, confpath, dirarg}
-	gitleaks_args = append(gitleaks_args, additional_args...)
-	// TEMP
-	var outb, errb bytes.Buffer
-	gl_cmd := exec.Command("gitleaks", gitleaks_args...)
-	gl_cmd.Stdout = &outb
-	gl_cmd.Stderr = &errb
-	log.Debug().Str("repo", repo.FullName).Msg("starting gitleaks scan")
-	if err := gl_cmd.Run(); err != nil {
-		log.Error().Err(err).Str("repo", repo.Name).Msg("error running gitleaks on the repo")
-		result.Err = err
-		results <- result
-		return
+	// local repos are scanned in place, cached repos are scanned in their
+	// mirror, and everything else is cloned into dir
+	scan_dir := dir
+	clone_ctx, cancel_clone := with_timeout(ctx, conf.clone_timeout)
+	defer cancel_clone()
+	if repo.localPath != "" {
+		scan_dir = repo.localPath
+	} else if conf.CloneCache.Dir != "" {
+		var cache_path string
+		var release func()
+		result.CloneAttempts, err = conf.Retry.Clone.do(clone_ctx, "clone "+repo.Name, func() error {
+			var err error
+			cache_path, release, err = cached_clone(clone_ctx, repo, conf.CloneCache.Dir)
+			return err
+		})
+		if err != nil {
+			if result.interrupted(clone_ctx, "clone", conf.clone_timeout) {
+				log.Warn().Err(result.Err).Str("repo", repo.Name).Msg("clone didn't finish")
+				return result
+			}
+			log.Error().Err(scrub_error(err, repo)).Str("repo", repo.Name).Int("attempts", result.CloneAttempts).Msg("failed to update cached clone")
+			result.Err = scrub_error(err, repo)
+			return result
+		}
+		defer release()
+		scan_dir = cache_path
+	} else if result.CloneAttempts, err = conf.Retry.Clone.do(clone_ctx, "clone "+repo.Name, func() error {
+		return clone_repo(clone_ctx, repo, dir)
+	}); err != nil {
+		if result.interrupted(clone_ctx, "clone", conf.clone_timeout) {
+			log.Warn().Err(result.Err).Str("repo", repo.Name).Msg("clone didn't finish")
+			return result
+		}
+		log.Error().Err(scrub_error(err, repo)).Str("repo", repo.Name).Int("attempts", result.CloneAttempts).Msg("failed to clone repo")
+		result.Err = scrub_error(err, repo)
+		return result
 	}
-	log.Debug().Str("repo", repo.FullName).Msg("finished gitleaks scan")
-
-	// code useful for debugging, but not for leaving compiled
-	// fmt.Println(outb.String())
-	// fmt.Println(errb.String())
-	// log.Debug().Str("stdout", outb.String()).Str("stderr", errb.String()).Msg("output from gitleaks")
-
-	// load the result into a GitleaksResult
-	resultfile, err := os.ReadFile(outputpath)
+	cancel_clone()
+	// run the scanner configured for the repo
+	scanner, err := new_scanner(scanner_name(repo, conf), gl_conf_path, conf)
 	if err != nil {
-		log.Error().Err(err).Str("repo", repo.Name).Msg("error opening results file")
+		log.Error().Err(err).Str("repo", repo.Name).Msg("failed to set up scanner")
 		result.Err = err
-		results <- result
-		return
+		return result
+	}
+	req := ScanRequest{Repo: repo, Dir: scan_dir, WorkDir: dir}
+	// with a state dir only the commits added since the last scan are
+	// scanned, if the scanner can limit itself to a commit range
+	var state *RepoState
+	incremental := false
+	if state_dir != "" && scanner.SupportsLogOpts() {
+		state, err = load_repo_state(state_dir, repo.HTMLURL)
+		if err != nil {
+			log.Warn().Err(err).Str("repo", repo.Name).Msg("failed to load repo state, running a full scan")
+		}
+		if log_opts := incremental_log_opts(scan_dir, state); log_opts != "" {
+			log.Debug().Str("repo", repo.FullName).Str("log_opts", log_opts).Msg("running incremental scan")
+			req.LogOpts = log_opts
+			incremental = true
+		}
 	}
-	jsonResults := make([]GitleaksResult, 0)
-	err = json.Unmarshal(resultfile, &jsonResults)
+	log.Debug().Str("repo", repo.FullName).Str("scanner", scanner.Name()).Msg("starting scan")
+	scan_ctx, cancel_scan := with_timeout(ctx, conf.scan_timeout)
+	defer cancel_scan()
+	var jsonResults []GitleaksResult
+	result.ScanAttempts, err = conf.Retry.Scan.do(scan_ctx, "scan "+repo.Name, func() error {
+		var err error
+		jsonResults, err = scanner.Scan(scan_ctx, req)
+		return err
+	})
 	if err != nil {
-		log.Error().Err(err).Str("repo", repo.Name).Msg("error unmarshaling gitleaks results")
-		result.Err = err
-		results <- result
-		return
+		if result.interrupted(scan_ctx, "scan", conf.scan_timeout) {
+			log.Warn().Err(result.Err).Str("repo", repo.Name).Str("scanner", scanner.Name()).Msg("scan didn't finish")
+			return result
+		}
+		log.Error().Err(scrub_error(err, repo)).Str("repo", repo.Name).Str("scanner", scanner.Name()).Int("attempts", result.ScanAttempts).Msg("error running scanner on the repo")
+		result.Err = scrub_error(err, repo)
+		return result
+	}
+	log.Debug().Str("repo", repo.FullName).Str("scanner", scanner.Name()).Msg("finished scan")
+	if state_dir != "" {
+		if incremental {
+			jsonResults = merge_findings(state.Findings, jsonResults, repo.HTMLURL)
+		}
+		save_scan_state(state_dir, repo, scan_dir, jsonResults)
 	}
+	// allow comments can only be read while the clone is around
+	jsonResults = annotate_inline_suppressions(scan_dir, jsonResults)
 	//success: return
 	result.Results = jsonResults
 	result.Err = nil
-	results <- result
+	return result
 }
 
 func skip_repo(repo *github.Repository, skipRepos []string) bool {
@@ -132,6 +186,37 @@ func extractOrgnames(orgs []OrgConfig) []string {
 	}
 	return orgnames
 }
+
+// get_all_repos enumerates every configured provider and local repo
+func get_all_repos(ctx context.Context, conf Conf) map[string]*GitRepo {
+	all_repos := make(map[string]*GitRepo, 0)
+	githubRepos := get_all_github_repos(ctx, conf.GithubConfig.OrgsToScan, conf)
+	for key, value := range githubRepos {
+		all_repos[key] = value
+	}
+	gitlab_repos := get_all_gitlab_repos(ctx, conf.GitlabConfig.OrgsToScan, conf)
+	for key, value := range gitlab_repos {
+		all_repos[key] = value
+	}
+	bitbucket_repos := get_all_bitbucket_repos(ctx, conf.BitbucketConfig.OrgsToScan, conf)
+	for key, value := range bitbucket_repos {
+		all_repos[key] = value
+	}
+	gitea_repos := get_all_gitea_repos(ctx, conf.GiteaConfig.OrgsToScan, conf)
+	for key, value := range gitea_repos {
+		all_repos[key] = value
+	}
+	azure_repos := get_all_azure_repos(ctx, conf.AzureDevOpsConfig.OrgsToScan, conf)
+	for key, value := range azure_repos {
+		all_repos[key] = value
+	}
+	local_repos := get_local_repos(conf.LocalConfig, conf.SkipRepos)
+	for key, value := range local_repos {
+		all_repos[key] = value
+	}
+	return all_repos
+}
+
 func main() {
 	// setup logging
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -142,13 +227,28 @@ func main() {
 	} else {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
-	// load the config file
 	confdir := os.Getenv("MOSS_CONFDIR")
 	if confdir == "" {
 		confdir = "./configs/conf.yml"
 	}
+	// subcommands work on previous outputs and don't need a full config
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := run_diff(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal().Err(err).Msg("diff failed")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "triage" {
+		if err := run_triage(os.Args[2:], config_findings_store(confdir), os.Stdout); err != nil {
+			log.Fatal().Err(err).Msg("triage failed")
+		}
+		return
+	}
+	started := time.Now()
+	// load the config file
 	var conf Conf
 	conf.getConfig(confdir)
+	api_retry = conf.Retry.API
 	// check the gitleaks.toml file exists and isn't empty
 	gitleaks_toml_path := os.Getenv("MOSS_GITLEAKSCONF")
 	if gitleaks_toml_path == "" {
@@ -158,42 +258,115 @@ func main() {
 	check_gitleaks_conf(gitleaks_toml_path)
 	//Check for scanning single repository
 	repoURL := flag.String("repo", "", "Repository URL to scan")
-	outputFormat := flag.String("format", "", "Output Format")
+	outputFormat := flag.String("format", "", "Comma separated output formats: markdown, json, html, sarif, csv or jsonl")
+	localPaths := flag.String("path", "", "Comma separated paths of local repositories to scan, skips provider enumeration")
+	baselinePath := flag.String("baseline", "", "Previous json output, findings in it are suppressed or marked as existing")
+	writeBaseline := flag.String("write-baseline", "", "Write a baseline of this run's findings to this path")
+	redaction := flag.String("redact", "", "How secrets are shown in reports: none, partial, full or hash")
+	resumeID := flag.String("resume", "", "Id of an interrupted run to resume, repos it finished aren't scanned again")
 	flag.Parse()
-	//collate all the repos
-	all_repos := make(map[string]*GitRepo, 0)
-	githubRepos := get_all_github_repos(conf.GithubConfig.OrgsToScan, conf)
-	for key, value := range githubRepos {
-		all_repos[key] = value
+	if err := conf.setup_redaction(*redaction); err != nil {
+		log.Fatal().Err(err).Msg("invalid redaction policy")
 	}
-	gitlab_repos := get_all_gitlab_repos(conf.GitlabConfig.OrgsToScan, conf)
-	for key, value := range gitlab_repos {
-		all_repos[key] = value
+	// ignored secrets are redacted like any other before they're logged
+	expiring_ignores := conf.Output.redact_ignores(conf.expiring_ignores(time.Now()), conf.secret_salt)
+	warn_expiring_ignores(expiring_ignores)
+	formats, err := parse_formats(*outputFormat, conf.Output.Format)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid output format")
 	}
-	// if we're debugging,  set a limit
-	repo_limit_s := os.Getenv("MOSS_DEBUG_LIMIT")
-	if repo_limit_s != "" {
-		repo_limit, err := strconv.Atoi(repo_limit_s)
-		if err != nil {
-			log.Error().Err(err).Str("MOSS_DEBUG_LIMIT", repo_limit_s).
-				Msg("failed to cast value for moss debug limit, setting to 10")
-			repo_limit = 10
+	if err := conf.setup_baseline(*baselinePath); err != nil {
+		log.Fatal().Err(err).Str("baseline", conf.Baseline).Msg("failed to load baseline")
+	}
+	if err := conf.setup_findings_store(); err != nil {
+		log.Fatal().Err(err).Str("findings_store", conf.FindingsStore).Msg("failed to open findings store")
+	}
+	// on SIGINT or SIGTERM running clones and scans are killed and a partial
+	// report is written. A second signal exits straight away, taking the
+	// clones and scans down with it since they're in their own process groups.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warn().Str("signal", sig.String()).Msg("canceling scans, a partial report will be written. signal again to exit now")
+		cancel()
+		sig = <-signals
+		log.Warn().Str("signal", sig.String()).Msg("exiting without a report")
+		abort_scans()
+		os.Exit(1)
+	}()
+	output_dir := os.Getenv("MOSS_OUTDIR")
+	if output_dir == "" {
+		output_dir = "/output"
+	}
+	checkpoint_base := checkpoint_base_dir(conf)
+	//collate all the repos
+	var all_repos map[string]*GitRepo
+	var checkpoint *runCheckpoint
+	done := make(map[string]GitleaksRepoResult)
+	if *resumeID != "" {
+		// a resumed run scans the repos the interrupted one enumerated
+		if checkpoint, err = open_checkpoint(checkpoint_base, *resumeID); err != nil {
+			log.Fatal().Err(err).Str("run_id", *resumeID).Msg("failed to resume run")
 		}
-		limit_repos := make(map[string]*GitRepo, 0)
-		counter := 0
-		for _, repo := range all_repos {
-			if counter == repo_limit {
-				break
+		all_repos = checkpoint.repos()
+		done = checkpoint.completed()
+		log.Info().Str("run_id", *resumeID).Int("repos", len(all_repos)).Int("completed", len(done)).Msg("resuming run")
+	} else {
+		if *localPaths != "" {
+			log.Debug().Str("paths", *localPaths).Msg("local paths specified, skipping provider enumeration")
+			all_repos = get_local_repos(conf.LocalConfig.with_paths(strings.Split(*localPaths, ",")), conf.SkipRepos)
+		} else {
+			all_repos = get_all_repos(ctx, conf)
+		}
+		// if we're debugging,  set a limit
+		repo_limit_s := os.Getenv("MOSS_DEBUG_LIMIT")
+		if repo_limit_s != "" {
+			repo_limit, err := strconv.Atoi(repo_limit_s)
+			if err != nil {
+				log.Error().Err(err).Str("MOSS_DEBUG_LIMIT", repo_limit_s).
+					Msg("failed to cast value for moss debug limit, setting to 10")
+				repo_limit = 10
+			}
+			limit_repos := make(map[string]*GitRepo, 0)
+			counter := 0
+			for _, repo := range all_repos {
+				if counter == repo_limit {
+					break
+				}
+				limit_repos[repo.HTMLURL] = repo
+				counter = counter + 1
 			}
-			limit_repos[repo.HTMLURL] = repo
-			counter = counter + 1
+			all_repos = limit_repos
 		}
-		all_repos = limit_repos
+	}
+	if ctx.Err() != nil {
+		log.Fatal().Msg("canceled while listing repos, nothing was scanned")
 	}
 	// make sure we have repos to scan and blow up if we don't
 	if len(all_repos) == 0 {
 		log.Fatal().Msg("no repos found to scan!")
 	}
+	// checkpoint the run so it can be resumed if it's interrupted, a single
+	// repo isn't worth resuming
+	if checkpoint == nil && *repoURL == "" {
+		run_id := new_run_id(started)
+		if checkpoint, err = create_checkpoint(checkpoint_base, run_id, started, all_repos); err != nil {
+			log.Warn().Err(err).Str("checkpoint_dir", checkpoint_base).Msg("failed to checkpoint the run, it can't be resumed")
+			checkpoint = nil
+		} else {
+			log.Info().Str("run_id", run_id).Msg("run checkpointed, resume it with -resume=" + run_id + " if it's interrupted")
+		}
+	}
+	// stream results to disk as they come in
+	var sink *streamSink
+	if conf.Output.Stream || conf.Output.StreamMarkdown {
+		if sink, err = open_stream_sink(output_dir, conf); err != nil {
+			log.Fatal().Err(err).Str("output_dir", output_dir).Msg("failed to open the result stream")
+		}
+	}
 	// build a semaphor for MaxConcurrency
 	sem := semaphore.NewWeighted(conf.MaxConcurrency)
 	// create the channel and kick off the scans
@@ -204,7 +377,7 @@ func main() {
 		repo := all_repos[*repoURL]
 		if *repo != (GitRepo{}) {
 			// Scan the specific repository using the scan_repo function
-			scan_repo(repo, gitleaks_toml_path, conf.GitLeaksConfig.AdditionalArgs, results, sem)
+			scan_repo(ctx, repo, gitleaks_toml_path, conf, results, sem)
 			//Clearing the all_repos to make sure the scan is 100%
 			all_repos = map[string]*GitRepo{
 				*repoURL: all_repos[*repoURL],
@@ -213,8 +386,13 @@ func main() {
 			log.Fatal().Str("repoURL", *repoURL).Msg("Repository not found in the org")
 		}
 	} else {
-		for _, repo := range all_repos {
-			go scan_repo(repo, gitleaks_toml_path, conf.GitLeaksConfig.AdditionalArgs, results, sem)
+		for url, repo := range all_repos {
+			// repos finished before the run was interrupted aren't scanned again
+			if result, ok := done[url]; ok {
+				go func(result GitleaksRepoResult) { results <- result }(result)
+				continue
+			}
+			go scan_repo(ctx, repo, gitleaks_toml_path, conf, results, sem)
 		}
 	}
 	// collect the results
@@ -222,7 +400,15 @@ func main() {
 	final_results := make([]GitleaksRepoResult, 0)
 	for {
 		repoResult := <-results
+		if checkpoint != nil {
+			if err := checkpoint.complete(repoResult); err != nil {
+				log.Warn().Err(err).Str("repo", repoResult.Repository).Msg("failed to checkpoint repo result")
+			}
+		}
 		repoResult.filterResults(conf)
+		if sink != nil {
+			sink.write(repoResult)
+		}
 		final_results = append(final_results, repoResult)
 		collected = collected + 1
 		log.Debug().Float32("percent_done", float32(collected)/float32(len(all_repos))).Msg("percent done")
@@ -230,33 +416,121 @@ func main() {
 			break
 		}
 	}
-
-	// format and output the results nicely
-	output_dir := os.Getenv("MOSS_OUTDIR")
-	if output_dir == "" {
-		output_dir = "/output"
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		log.Warn().Msg("the run was canceled, writing a partial report")
 	}
 
 	all_orgs := append(extractOrgnames(conf.GithubConfig.OrgsToScan), extractOrgnames(conf.GitlabConfig.OrgsToScan)...)
-	*outputFormat = strings.ToLower(*outputFormat)
-	if *outputFormat == "" {
-		*outputFormat = strings.ToLower(conf.Output.Format)
-	}
-	if *outputFormat == "json" {
-		output := json_output(final_results, all_orgs)
-		// todo: make this part of the conf
-		outpath := fmt.Sprintf("%s/output.json", output_dir)
-		log.Debug().Str("outpath", outpath).Msg("writing json output")
-		os.WriteFile(outpath, []byte(output), 0644)
-	} else if *outputFormat == "html" {
-		err := html_output(final_results, all_orgs, "")
-		if err != nil {
-			log.Error().Err(err).Msg("Error creating html output")
+	all_orgs = append(all_orgs, extractOrgnames(conf.BitbucketConfig.OrgsToScan)...)
+	all_orgs = append(all_orgs, extractOrgnames(conf.GiteaConfig.OrgsToScan)...)
+	all_orgs = append(all_orgs, extractOrgnames(conf.AzureDevOpsConfig.OrgsToScan)...)
+	if *localPaths != "" || len(conf.LocalConfig.Paths) > 0 || len(conf.LocalConfig.GitURLs) > 0 {
+		all_orgs = append(all_orgs, local_org_name(conf.LocalConfig))
+	}
+	if *resumeID != "" {
+		all_orgs = checkpoint.orgs(all_orgs)
+	}
+
+	// save what this run saw so it can be triaged
+	if conf.findings != nil {
+		if err := conf.findings.save(); err != nil {
+			log.Error().Err(err).Str("findings_store", conf.FindingsStore).Msg("failed to save findings store")
+		}
+	}
+
+	// reports only ever see redacted secrets
+	final_results = conf.Output.redact_results(final_results)
+
+	// the baseline holds everything found, so write it before applying one
+	if *writeBaseline != "" && interrupted {
+		log.Warn().Str("path", *writeBaseline).Msg("not writing a baseline from a partial run")
+	} else if *writeBaseline != "" {
+		log.Info().Str("path", *writeBaseline).Msg("writing baseline")
+		if err := os.WriteFile(*writeBaseline, []byte(json_output(final_results, all_orgs)), 0644); err != nil {
+			log.Error().Err(err).Str("path", *writeBaseline).Msg("failed to write baseline")
+		}
+	}
+	for i := range final_results {
+		final_results[i].applyBaseline(conf)
+	}
+	extras := reportExtras{
+		ExpiringIgnores: expiring_ignores,
+		UniqueSecrets:   dedup_secrets(final_results, all_orgs),
+	}
+
+	// keep the clone cache under its size cap now that nothing is scanning
+	if conf.CloneCache.Dir != "" {
+		if err := evict_clone_cache(conf.CloneCache.Dir, conf.CloneCache.MaxSizeMB*1024*1024); err != nil {
+			log.Warn().Err(err).Msg("failed to evict from the clone cache")
 		}
-	} else if *outputFormat == "markdown" {
-		mdown_out := markdown_output(final_results, all_orgs)
-		outpath := fmt.Sprintf("%s/output.md", output_dir)
-		log.Debug().Str("outpath", outpath).Msg("writing markdown output")
-		os.WriteFile(outpath, []byte(mdown_out), 0644)
 	}
+
+	write_outputs(formats, output_dir, final_results, all_orgs, extras, gitleaks_toml_path)
+	if sink != nil {
+		sink.finish(summarize_run(final_results, extras, started, formats))
+	}
+	// the reports are written, there's nothing left to resume unless the
+	// run was cut short
+	if checkpoint != nil && interrupted {
+		log.Warn().Str("run_id", checkpoint.manifest.ID).Msg("resume the run with -resume=" + checkpoint.manifest.ID)
+	} else if checkpoint != nil {
+		if err := checkpoint.remove(); err != nil {
+			log.Warn().Err(err).Msg("failed to remove the run checkpoint")
+		}
+	}
+	if interrupted {
+		os.Exit(1)
+	}
+}
+
+// write_outputs writes the report in each of the formats to output_dir
+func write_outputs(formats []string, output_dir string, results []GitleaksRepoResult, orgs []string, extras reportExtras, gitleaks_toml_path string) {
+	for _, format := range formats {
+		var output string
+		switch format {
+		case "json":
+			output = json_report(results, orgs, extras)
+		case "html":
+			outpath := fmt.Sprintf("%s/output.html", output_dir)
+			if err := html_output(results, orgs, extras, outpath); err != nil {
+				log.Error().Err(err).Msg("Error creating html output")
+			}
+			continue
+		case "sarif":
+			// the rule catalog comes from the same toml gitleaks scanned with
+			gl_conf, err := load_gitleaks_config(gitleaks_toml_path)
+			if err != nil {
+				log.Warn().Err(err).Str("path", gitleaks_toml_path).Msg("failed to parse gitleaks toml, sarif rules will only include rules with findings")
+			}
+			output = sarif_output(results, orgs, gl_conf, extras)
+		case "markdown":
+			output = markdown_output(results, orgs) + incomplete_markdown(results, orgs) +
+				unique_secrets_markdown(extras.UniqueSecrets) + expiring_ignores_markdown(extras.ExpiringIgnores)
+		case "csv":
+			output = csv_output(results, orgs)
+			// unique secrets don't fit the finding columns, they get their own file
+			if len(extras.UniqueSecrets) > 0 {
+				outpath := fmt.Sprintf("%s/unique_secrets.csv", output_dir)
+				if err := os.WriteFile(outpath, []byte(unique_secrets_csv(extras.UniqueSecrets)), 0644); err != nil {
+					log.Error().Err(err).Str("outpath", outpath).Msg("failed to write output")
+				}
+			}
+		case "jsonl":
+			output = jsonl_output(results, orgs, extras)
+		}
+		outpath := fmt.Sprintf("%s/%s", output_dir, output_filename(format))
+		log.Debug().Str("outpath", outpath).Str("format", format).Msg("writing output")
+		if err := os.WriteFile(outpath, []byte(output), 0644); err != nil {
+			log.Error().Err(err).Str("outpath", outpath).Msg("failed to write output")
+		}
+	}
+}
+
+// output_filename is the file each format is written to in the output dir
+func output_filename(format string) string {
+	if format == "markdown" {
+		return "output.md"
+	}
+	return "output." + format
 }
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// native_rules_cache keeps compiled rule sets per toml path so every repo
+// scan doesn't recompile the same regexes
+var native_rules_cache sync.Map
+
+type nativeAllowlist struct {
+	regexes   []*regexp.Regexp
+	paths     []*regexp.Regexp
+	commits   map[string]bool
+	stopwords []string
+}
+
+type nativeRule struct {
+	GitleaksRule
+	regex     *regexp.Regexp
+	path      *regexp.Regexp
+	keywords  []string
+	allowlist nativeAllowlist
+}
+
+type nativeRules struct {
+	rules     []nativeRule
+	allowlist nativeAllowlist
+}
+
+func compile_allowlist(al GitleaksAllowlist) (nativeAllowlist, error) {
+	compiled := nativeAllowlist{commits: make(map[string]bool)}
+	for _, expr := range al.Regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return compiled, fmt.Errorf("allowlist regex %q: %w", expr, err)
+		}
+		compiled.regexes = append(compiled.regexes, re)
+	}
+	for _, expr := range al.Paths {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return compiled, fmt.Errorf("allowlist path %q: %w", expr, err)
+		}
+		compiled.paths = append(compiled.paths, re)
+	}
+	for _, commit := range al.Commits {
+		compiled.commits[commit] = true
+	}
+	for _, word := range al.StopWords {
+		compiled.stopwords = append(compiled.stopwords, strings.ToLower(word))
+	}
+	return compiled, nil
+}
+
+// compile_rules compiles a parsed gitleaks config into matchers
+func compile_rules(gl_conf *GitleaksToml) (*nativeRules, error) {
+	global, err := compile_allowlist(gl_conf.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &nativeRules{allowlist: global}
+	for _, rule := range gl_conf.Rules {
+		n_rule := nativeRule{GitleaksRule: rule}
+		if rule.Regex != "" {
+			if n_rule.regex, err = regexp.Compile(rule.Regex); err != nil {
+				return nil, fmt.Errorf("rule %s regex: %w", rule.ID, err)
+			}
+		}
+		if rule.Path != "" {
+			if n_rule.path, err = regexp.Compile(rule.Path); err != nil {
+				return nil, fmt.Errorf("rule %s path: %w", rule.ID, err)
+			}
+		}
+		for _, kw := range rule.Keywords {
+			n_rule.keywords = append(n_rule.keywords, strings.ToLower(kw))
+		}
+		if n_rule.allowlist, err = compile_allowlist(rule.Allowlist); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		compiled.rules = append(compiled.rules, n_rule)
+	}
+	return compiled, nil
+}
+
+func load_native_rules(gl_conf_path string) (*nativeRules, error) {
+	if cached, ok := native_rules_cache.Load(gl_conf_path); ok {
+		return cached.(*nativeRules), nil
+	}
+	gl_conf, err := load_gitleaks_config(gl_conf_path)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := compile_rules(gl_conf)
+	if err != nil {
+		return nil, err
+	}
+	native_rules_cache.Store(gl_conf_path, compiled)
+	return compiled, nil
+}
+
+// shannon_entropy is the entropy of s in bits per character
+func shannon_entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	entropy := 0.0
+	length := float64(len([]rune(s)))
+	for _, count := range counts {
+		freq := float64(count) / length
+		entropy -= freq * math.Log2(freq)
+	}
+	return entropy
+}
+
+func contains_digit(s string) bool {
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (al nativeAllowlist) path_allowed(path string) bool {
+	for _, re := range al.paths {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (al nativeAllowlist) secret_allowed(secret string) bool {
+	for _, re := range al.regexes {
+		if re.MatchString(secret) {
+			return true
+		}
+	}
+	lower := strings.ToLower(secret)
+	for _, word := range al.stopwords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitCommit is the metadata of the commit a fragment was added in
+type gitCommit struct {
+	SHA     string
+	Author  string
+	Email   string
+	Date    string
+	Message string
+}
+
+// gitFragment is a run of lines added to a file in a commit. FirstInFile is
+// set on the first fragment of each file in a commit.
+type gitFragment struct {
+	Commit      gitCommit
+	File        string
+	StartLine   int
+	Lines       []string
+	FirstInFile bool
+}
+
+// detect runs every rule over a fragment, following gitleaks' semantics
+func (nr *nativeRules) detect(frag gitFragment) []GitleaksResult {
+	findings := make([]GitleaksResult, 0)
+	if nr.allowlist.commits[frag.Commit.SHA] || nr.allowlist.path_allowed(frag.File) {
+		return findings
+	}
+	raw := strings.Join(frag.Lines, "\n")
+	lower := strings.ToLower(raw)
+	for _, rule := range nr.rules {
+		if rule.allowlist.commits[frag.Commit.SHA] || rule.allowlist.path_allowed(frag.File) {
+			continue
+		}
+		if rule.path != nil && !rule.path.MatchString(frag.File) {
+			continue
+		}
+		// path only rules flag the file itself, once per commit
+		if rule.regex == nil {
+			if rule.path != nil && frag.FirstInFile {
+				findings = append(findings, native_finding(rule, frag, "file detected: "+frag.File, "", 0, 0))
+			}
+			continue
+		}
+		if len(rule.keywords) > 0 {
+			found := false
+			for _, kw := range rule.keywords {
+				if strings.Contains(lower, kw) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		for _, loc := range rule.regex.FindAllStringIndex(raw, -1) {
+			match := raw[loc[0]:loc[1]]
+			secret := match
+			if rule.SecretGroup > 0 {
+				groups := rule.regex.FindStringSubmatch(match)
+				if len(groups) <= rule.SecretGroup {
+					continue
+				}
+				secret = groups[rule.SecretGroup]
+			}
+			if nr.allowlist.secret_allowed(secret) || rule.allowlist.secret_allowed(secret) {
+				continue
+			}
+			if rule.Entropy != 0 {
+				if shannon_entropy(secret) <= rule.Entropy {
+					continue
+				}
+				// generic rules also need a digit to cut down on words
+				if strings.HasPrefix(rule.ID, "generic") && !contains_digit(secret) {
+					continue
+				}
+			}
+			findings = append(findings, native_finding(rule, frag, strings.TrimSuffix(match, "\n"), secret, loc[0], loc[1]))
+		}
+	}
+	return findings
+}
+
+// native_finding builds a finding for raw[start:end] of the fragment
+func native_finding(rule nativeRule, frag gitFragment, match string, secret string, start int, end int) GitleaksResult {
+	raw := strings.Join(frag.Lines, "\n")
+	start_line := strings.Count(raw[:start], "\n")
+	end_line := strings.Count(raw[:end], "\n")
+	start_col := start - (strings.LastIndex(raw[:start], "\n") + 1) + 1
+	end_col := end - (strings.LastIndex(raw[:end], "\n") + 1)
+	tags := make([]interface{}, 0)
+	for _, tag := range rule.Tags {
+		tags = append(tags, tag)
+	}
+	return GitleaksResult{
+		Description: rule.Description,
+		StartLine:   frag.StartLine + start_line,
+		EndLine:     frag.StartLine + end_line,
+		StartColumn: start_col,
+		EndColumn:   end_col,
+		Match:       match,
+		Secret:      secret,
+		File:        frag.File,
+		Commit:      frag.Commit.SHA,
+		Entropy:     float32(shannon_entropy(secret)),
+		Author:      frag.Commit.Author,
+		Email:       frag.Commit.Email,
+		Date:        frag.Commit.Date,
+		Message:     frag.Commit.Message,
+		Tags:        tags,
+		RuleID:      rule.ID,
+	}
+}
+
+// commit_marker starts each commit in the git log output. The NUL bytes
+// can't appear in a diff line, so it can't be confused with file content.
+const commit_marker = "\x00moss-commit\x00"
+
+var hunk_header = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunk_count parses the optional line count of a hunk range, which is 1
+// when left out
+func hunk_count(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// parse_diff_path turns a "+++ b/path" line into the file path
+func parse_diff_path(line string) string {
+	path := strings.TrimPrefix(line, "+++ ")
+	if strings.HasPrefix(path, "\"") {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+	}
+	if path == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(path, "b/")
+}
+
+// walk_git_log parses `git log -p -U0` output and calls emit with every
+// fragment of added lines
+func walk_git_log(r io.Reader, emit func(gitFragment)) error {
+	reader := bufio.NewReader(r)
+	var commit gitCommit
+	var frag *gitFragment
+	file := ""
+	file_emitted := false
+	// lines left in the current hunk, content lines can look like headers
+	old_left, new_left := 0, 0
+	flush := func() {
+		if frag != nil && len(frag.Lines) > 0 {
+			frag.FirstInFile = !file_emitted
+			file_emitted = true
+			emit(*frag)
+		}
+		frag = nil
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			if err == io.EOF {
+				flush()
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if old_left > 0 || new_left > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				new_left--
+				if frag != nil {
+					frag.Lines = append(frag.Lines, strings.TrimSuffix(line[1:], "\r"))
+				}
+			case strings.HasPrefix(line, "-"):
+				old_left--
+			case strings.HasPrefix(line, "\\"):
+				// "\ No newline at end of file"
+			default:
+				old_left--
+				new_left--
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, commit_marker):
+			flush()
+			file = ""
+			file_emitted = false
+			parts := strings.SplitN(strings.TrimPrefix(line, commit_marker), "\x00", 5)
+			for len(parts) < 5 {
+				parts = append(parts, "")
+			}
+			date := parts[3]
+			if t, err := time.Parse(time.RFC3339, date); err == nil {
+				date = t.UTC().Format("2006-01-02T15:04:05Z")
+			}
+			commit = gitCommit{SHA: parts[0], Author: parts[1], Email: parts[2], Date: date, Message: parts[4]}
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			file = ""
+			file_emitted = false
+		case strings.HasPrefix(line, "+++ "):
+			file = parse_diff_path(line)
+		case strings.HasPrefix(line, "--- "):
+			// old file name, the new one follows
+		case strings.HasPrefix(line, "@@ "):
+			flush()
+			m := hunk_header.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			old_left, new_left = hunk_count(m[1]), hunk_count(m[3])
+			start, _ := strconv.Atoi(m[2])
+			if file == "" {
+				continue
+			}
+			frag = &gitFragment{Commit: commit, File: file, StartLine: start}
+		}
+	}
+}
+
+// nativeScanner detects secrets in process with the rules from the gitleaks
+// toml, so no scanner binary has to be installed
+type nativeScanner struct {
+	ConfigPath string
+}
+
+func (s *nativeScanner) Name() string {
+	return "native"
+}
+
+func (s *nativeScanner) SupportsLogOpts() bool {
+	return true
+}
+
+func (s *nativeScanner) Scan(ctx context.Context, req ScanRequest) ([]GitleaksResult, error) {
+	rules, err := load_native_rules(s.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gitleaks rules: %w", err)
+	}
+	// exec args can't hold NUL bytes, git writes them from %x00
+	marker := strings.ReplaceAll(commit_marker, "\x00", "%x00")
+	format := "--format=" + marker + "%H%x00%an%x00%ae%x00%aI%x00%s"
+	args := []string{"-C", req.Dir, "log", "-p", "-U0", "--no-color", "--no-ext-diff", format}
+	if req.LogOpts != "" {
+		args = append(args, strings.Fields(req.LogOpts)...)
+	} else {
+		args = append(args, "--full-history", "--all")
+	}
+	var errb bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	kill_on_cancel(cmd)
+	cmd.Stderr = &errb
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := start_cmd(cmd); err != nil {
+		return nil, err
+	}
+	findings := make([]GitleaksResult, 0)
+	walk_err := walk_git_log(stdout, func(frag gitFragment) {
+		findings = append(findings, rules.detect(frag)...)
+	})
+	if walk_err != nil {
+		// git blocks writing to the pipe nobody reads anymore, Wait would
+		// never return
+		kill_process_group(cmd.Process)
+		wait_cmd(cmd)
+		return nil, walk_err
+	}
+	if err := wait_cmd(cmd); err != nil {
+		return nil, fmt.Errorf("git log: %w: %s", err, strings.TrimSpace(errb.String()))
+	}
+	return findings, nil
+}
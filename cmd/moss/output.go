@@ -3,6 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -30,6 +35,29 @@ func json_output(results []GitleaksRepoResult, orgs []string) string {
 	return string(j_string)
 }
 
+// reportExtras are the report sections about the run as a whole rather
+// than a single repo
+type reportExtras struct {
+	ExpiringIgnores []ExpiringIgnore
+	UniqueSecrets   []UniqueSecret
+}
+
+// json_report is the json output along with the run wide sections. Those
+// are kept under keys starting with _ so they can't clash with an org.
+func json_report(results []GitleaksRepoResult, orgs []string, extras reportExtras) string {
+	report := make(map[string]interface{})
+	for org, org_results := range get_json_obj(results, orgs) {
+		report[org] = org_results
+	}
+	report["_unique_secrets"] = extras.UniqueSecrets
+	report["_expiring_ignores"] = extras.ExpiringIgnores
+	j_string, err := json.Marshal(report)
+	if err != nil {
+		log.Fatal().Msg("Failed to marshal json results")
+	}
+	return string(j_string)
+}
+
 func markdown_output(results []GitleaksRepoResult, orgs []string) string {
 	json_res := get_json_obj(results, orgs)
 	markdown_out := "# MOSS Results\n"
@@ -62,39 +90,326 @@ func markdown_output(results []GitleaksRepoResult, orgs []string) string {
 				continue
 			}
 			// repo header
-			markdown_out = fmt.Sprintf("%s### %s\n", markdown_out, repo_result.Repository)
-			// start a table
-			markdown_out = fmt.Sprintf("%s<details>\n  <summary>Repository Details</summary>\n\n", markdown_out)
-			markdown_out = fmt.Sprintf("%s|File Link|Type|Secret|Commit|\n|---------|----|------|------|\n", markdown_out)
-			// foreach finding, add a row
-			for _, finding := range repo_result.Results {
-				row := "|"
-				// file
-				row = fmt.Sprintf("%s%s|", row, finding.File)
-				// type
-				row = fmt.Sprintf("%s%s|", row, finding.Description)
-				// secret
-				if len(finding.Secret) > 10 {
-					row = fmt.Sprintf("%s%s|", row, finding.Secret[:10])
-				} else {
-					row = fmt.Sprintf("%s%s|", row, finding.Secret)
-				}
-				// commit
-				commit_url := fmt.Sprintf("%s/commit/%s", repo_result.URL, finding.Commit)
-				commit_link := fmt.Sprintf("[%s](%s)", finding.Commit[:7], commit_url)
-				row = fmt.Sprintf("%s%s|", row, commit_link)
-				// append the rown to markdown_out and add a newline
-				markdown_out = fmt.Sprintf("%s%s\n", markdown_out, row)
-			}
-			//add an additional newline to make the markdown nice
-			markdown_out = fmt.Sprintf("%s\n</details>\n\n", markdown_out)
+			markdown_out = fmt.Sprintf("%s### %s\n%s", markdown_out, repo_result.Repository, markdown_repo_table(repo_result))
 		}
 	}
+	markdown_out = fmt.Sprintf("%s%s", markdown_out, suppressed_markdown(results, orgs))
 	return markdown_out
 }
 
-func html_output(results []GitleaksRepoResult, orgs []string, outpath string) error {
+// markdown_repo_table is the collapsible table of a repo's findings
+func markdown_repo_table(repo_result GitleaksRepoResult) string {
+	// start a table
+	markdown_out := "<details>\n  <summary>Repository Details</summary>\n\n"
+	markdown_out = fmt.Sprintf("%s|File Link|Type|Secret|Commit|\n|---------|----|------|------|\n", markdown_out)
+	// foreach finding, add a row
+	for _, finding := range repo_result.Results {
+		row := "|"
+		// file, findings already in the baseline are flagged
+		if finding.BaselineState == baseline_existing {
+			row = fmt.Sprintf("%s%s (existing)|", row, finding.File)
+		} else {
+			row = fmt.Sprintf("%s%s|", row, finding.File)
+		}
+		// type
+		row = fmt.Sprintf("%s%s|", row, finding.Description)
+		// secret
+		row = fmt.Sprintf("%s%s|", row, display_secret(finding))
+		// commit
+		row = fmt.Sprintf("%s%s|", row, commit_link_markdown(repo_result.Provider, repo_result.URL, finding.Commit))
+		// append the rown to markdown_out and add a newline
+		markdown_out = fmt.Sprintf("%s%s\n", markdown_out, row)
+	}
+	//add an additional newline to make the markdown nice
+	return fmt.Sprintf("%s\n</details>\n\n", markdown_out)
+}
+
+// suppressed_markdown lists findings the repos suppressed themselves, so
+// suppressions stay visible to reviewers
+func suppressed_markdown(results []GitleaksRepoResult, orgs []string) string {
 	json_res := get_json_obj(results, orgs)
-	_ = json_res
-	return nil
+	rows := ""
+	for _, org := range orgs {
+		for _, repo_result := range json_res[org] {
+			for _, finding := range repo_result.Suppressed {
+				commit_link := commit_link_markdown(repo_result.Provider, repo_result.URL, finding.Commit)
+				rows = fmt.Sprintf("%s|%s/%s|%s|%s|%s|%s|%s|%s|\n", rows, org, repo_result.Repository, finding.File,
+					finding.Description, finding.Suppression.Kind, finding.Suppression.Reason, finding.Suppression.Expires, commit_link)
+			}
+		}
+	}
+	if rows == "" {
+		return ""
+	}
+	return fmt.Sprintf("## Suppressed\n<details>\n  <summary>Suppressed findings</summary>\n\n"+
+		"|Repository|File|Type|Kind|Reason|Expires|Commit|\n|----------|----|----|----|------|-------|------|\n%s\n</details>\n\n", rows)
+}
+
+type htmlFinding struct {
+	RuleID      string
+	Description string
+	File        string
+	FileURL     string
+	StartLine   int
+	EndLine     int
+	Secret      string
+	ShortCommit string
+	CommitURL   string
+	Author      string
+	Email       string
+	Date        string
+	Existing    bool
+}
+
+type htmlRepo struct {
+	Name     string
+	URL      string
+	Private  bool
+	Err      string
+	Findings []htmlFinding
+}
+
+type htmlOrg struct {
+	Name     string
+	Repos    []htmlRepo
+	Findings int
+	Errors   int
+}
+
+// htmlSuppressed is a suppressed finding listed at the end of the report
+type htmlSuppressed struct {
+	Org         string
+	Repository  string
+	RepoURL     string
+	File        string
+	FileURL     string
+	RuleID      string
+	Kind        string
+	Reason      string
+	Expires     string
+	CommitURL   string
+	ShortCommit string
+}
+
+type htmlReport struct {
+	Generated         string
+	Orgs              []htmlOrg
+	Suppressed        []htmlSuppressed
+	ExpiringIgnores   []ExpiringIgnore
+	UniqueSecrets     []htmlUniqueSecret
+	TotalRepos        int
+	ReposWithFindings int
+	TotalFindings     int
+	Errors            int
+}
+
+type htmlUniqueSecret struct {
+	Hash           string
+	ShortHash      string
+	RuleIDs        string
+	Repos          int
+	Locations      []htmlSecretLocation
+	FirstSeen      string
+	EarliestAuthor string
+}
+
+type htmlSecretLocation struct {
+	Name        string
+	File        string
+	FileURL     string
+	StartLine   int
+	ShortCommit string
+	CommitURL   string
+}
+
+// short_commit returns the abbreviated sha used for display
+func short_commit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// has_web_ui reports whether permalinks can be built from a repo url,
+// plain git remotes that aren't http don't have one
+func has_web_ui(repo_url string) bool {
+	return strings.HasPrefix(repo_url, "https://") || strings.HasPrefix(repo_url, "http://")
+}
+
+// bitbucket_server_url tells Bitbucket Data Center repo urls, which look
+// like /projects/KEY/repos/slug, from Bitbucket Cloud ones
+func bitbucket_server_url(repo_url string) bool {
+	return strings.Contains(repo_url, "/projects/") && strings.Contains(repo_url, "/repos/")
+}
+
+// commit_permalink builds a link to the commit on the repo's web UI, in the
+// provider's url scheme. It's empty for repos without a web UI.
+func commit_permalink(provider string, repo_url string, commit string) string {
+	if !has_web_ui(repo_url) {
+		return ""
+	}
+	repo_url = strings.TrimSuffix(repo_url, "/")
+	if provider == "BITBUCKET" {
+		return fmt.Sprintf("%s/commits/%s", repo_url, commit)
+	}
+	return fmt.Sprintf("%s/commit/%s", repo_url, commit)
+}
+
+// file_permalink builds a link to the lines of the file at the commit the
+// finding was introduced in. GitHub's form is the fallback, GitLab
+// redirects /blob/ to /-/blob/ so it works there too.
+func file_permalink(provider string, repo_url string, finding GitleaksResult) string {
+	if !has_web_ui(repo_url) {
+		return ""
+	}
+	repo_url = strings.TrimSuffix(repo_url, "/")
+	path := (&url.URL{Path: finding.File}).EscapedPath()
+	start, end := finding.StartLine, finding.EndLine
+	if end < start {
+		end = start
+	}
+	switch {
+	case provider == "BITBUCKET" && bitbucket_server_url(repo_url):
+		link := fmt.Sprintf("%s/browse/%s?at=%s", repo_url, path, finding.Commit)
+		if start > 0 {
+			link = fmt.Sprintf("%s#%d-%d", link, start, end)
+		}
+		return link
+	case provider == "BITBUCKET":
+		link := fmt.Sprintf("%s/src/%s/%s", repo_url, finding.Commit, path)
+		if start > 0 {
+			link = fmt.Sprintf("%s#lines-%d:%d", link, start, end)
+		}
+		return link
+	case provider == "AZURE_DEVOPS":
+		link := fmt.Sprintf("%s?path=%s&version=GC%s", repo_url, url.QueryEscape("/"+finding.File), finding.Commit)
+		if start > 0 {
+			// the selection runs up to a column, so end at the start of the next line
+			link = fmt.Sprintf("%s&line=%d&lineEnd=%d&lineStartColumn=1&lineEndColumn=1", link, start, end+1)
+		}
+		return link
+	}
+	link := fmt.Sprintf("%s/blob/%s/%s", repo_url, finding.Commit, path)
+	if provider == "GITEA" {
+		link = fmt.Sprintf("%s/src/commit/%s/%s", repo_url, finding.Commit, path)
+	}
+	if start > 0 {
+		link = fmt.Sprintf("%s#L%d", link, start)
+		if end > start {
+			link = fmt.Sprintf("%s-L%d", link, end)
+		}
+	}
+	return link
+}
+
+// commit_link_markdown is the short commit, linked if the repo has a web UI
+func commit_link_markdown(provider string, repo_url string, commit string) string {
+	link := commit_permalink(provider, repo_url, commit)
+	if link == "" {
+		return short_commit(commit)
+	}
+	return fmt.Sprintf("[%s](%s)", short_commit(commit), link)
+}
+
+func build_html_report(results []GitleaksRepoResult, orgs []string) htmlReport {
+	json_res := get_json_obj(results, orgs)
+	report := htmlReport{
+		Generated: time.Now().UTC().Format(time.RFC1123),
+		Orgs:      make([]htmlOrg, 0),
+	}
+	// walk the orgs in config order so the report is stable between runs
+	for _, org := range orgs {
+		h_org := htmlOrg{Name: org, Repos: make([]htmlRepo, 0)}
+		for _, repo_result := range json_res[org] {
+			h_repo := htmlRepo{
+				Name:     repo_result.Repository,
+				URL:      repo_result.URL,
+				Private:  repo_result.IsPrivate,
+				Findings: make([]htmlFinding, 0),
+			}
+			if repo_result.Err != nil {
+				h_repo.Err = repo_result.Err.Error()
+				h_org.Errors = h_org.Errors + 1
+			}
+			for _, finding := range repo_result.Results {
+				h_repo.Findings = append(h_repo.Findings, htmlFinding{
+					RuleID:      finding.RuleID,
+					Description: finding.Description,
+					File:        finding.File,
+					FileURL:     file_permalink(repo_result.Provider, repo_result.URL, finding),
+					StartLine:   finding.StartLine,
+					EndLine:     finding.EndLine,
+					Secret:      display_secret(finding),
+					ShortCommit: short_commit(finding.Commit),
+					CommitURL:   commit_permalink(repo_result.Provider, repo_result.URL, finding.Commit),
+					Author:      finding.Author,
+					Email:       finding.Email,
+					Date:        finding.Date,
+					Existing:    finding.BaselineState == baseline_existing,
+				})
+			}
+			for _, finding := range repo_result.Suppressed {
+				report.Suppressed = append(report.Suppressed, htmlSuppressed{
+					Org:         org,
+					Repository:  repo_result.Repository,
+					RepoURL:     repo_result.URL,
+					File:        finding.File,
+					FileURL:     file_permalink(repo_result.Provider, repo_result.URL, finding),
+					RuleID:      finding.RuleID,
+					Kind:        finding.Suppression.Kind,
+					Reason:      finding.Suppression.Reason,
+					Expires:     finding.Suppression.Expires,
+					CommitURL:   commit_permalink(repo_result.Provider, repo_result.URL, finding.Commit),
+					ShortCommit: short_commit(finding.Commit),
+				})
+			}
+			if len(h_repo.Findings) > 0 {
+				report.ReposWithFindings = report.ReposWithFindings + 1
+			}
+			h_org.Findings = h_org.Findings + len(h_repo.Findings)
+			h_org.Repos = append(h_org.Repos, h_repo)
+		}
+		report.TotalRepos = report.TotalRepos + len(h_org.Repos)
+		report.TotalFindings = report.TotalFindings + h_org.Findings
+		report.Errors = report.Errors + h_org.Errors
+		report.Orgs = append(report.Orgs, h_org)
+	}
+	return report
+}
+
+func html_output(results []GitleaksRepoResult, orgs []string, extras reportExtras, outpath string) error {
+	tmpl, err := template.New("report").Parse(html_report_template)
+	if err != nil {
+		return err
+	}
+	report := build_html_report(results, orgs)
+	report.ExpiringIgnores = append(report.ExpiringIgnores, extras.ExpiringIgnores...)
+	for _, u := range extras.UniqueSecrets {
+		h_unique := htmlUniqueSecret{
+			Hash:           u.Hash,
+			ShortHash:      short_hash(u.Hash),
+			RuleIDs:        strings.Join(u.RuleIDs, ", "),
+			Repos:          len(u.Repos),
+			FirstSeen:      u.FirstSeen,
+			EarliestAuthor: u.EarliestAuthor,
+		}
+		for _, l := range u.Locations {
+			h_unique.Locations = append(h_unique.Locations, htmlSecretLocation{
+				Name:        fmt.Sprintf("%s/%s", l.Org, l.Repository),
+				File:        l.File,
+				FileURL:     file_permalink(l.Provider, l.URL, GitleaksResult{File: l.File, Commit: l.Commit, StartLine: l.StartLine}),
+				StartLine:   l.StartLine,
+				ShortCommit: short_commit(l.Commit),
+				CommitURL:   commit_permalink(l.Provider, l.URL, l.Commit),
+			})
+		}
+		report.UniqueSecrets = append(report.UniqueSecrets, h_unique)
+	}
+	f, err := os.Create(outpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	log.Debug().Str("outpath", outpath).Msg("writing html output")
+	return tmpl.Execute(f, report)
 }
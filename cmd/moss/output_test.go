@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func getRepoResult() GitleaksRepoResult {
+	return GitleaksRepoResult{
+		Repository: "repo",
+		Org:        "org",
+		URL:        "https://github.com/org/repo",
+		Err:        nil,
+		IsPrivate:  true,
+		Results: []GitleaksResult{{
+			Description: "Generic API Key",
+			StartLine:   63,
+			EndLine:     64,
+			StartColumn: 16,
+			EndColumn:   1,
+			Match:       "Keygrip = DEADBEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEF",
+			Secret:      "DEADBEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEF",
+			File:        "somefolder/README.md",
+			Commit:      "BEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEFDEAD",
+			Entropy:     3.6257162,
+			Author:      "John Smit",
+			Email:       "john.smith@example.com",
+			Date:        "2021-07-02T18:44:24Z",
+			Message:     "(maint) Clarify gpg-preset-passphrase instructions.",
+			Tags:        make([]interface{}, 0),
+			RuleID:      "generic-api-key",
+		}},
+	}
+}
+
+func TestHtmlOutput(t *testing.T) {
+	outpath := fmt.Sprintf("%s/output.html", t.TempDir())
+	results := []GitleaksRepoResult{
+		getRepoResult(),
+		{Repository: "clean", Org: "org", URL: "https://github.com/org/clean"},
+	}
+	err := html_output(results, []string{"org", "empty_org"}, reportExtras{}, outpath)
+	if err != nil {
+		t.Fatalf("html_output returned an error: %v", err)
+	}
+	out, err := os.ReadFile(outpath)
+	if err != nil {
+		t.Fatalf("failed to read html output: %v", err)
+	}
+	html := string(out)
+	wanted := []string{
+		"https://github.com/org/repo/commit/BEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEFDEAD",
+		"https://github.com/org/repo/blob/BEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEFDEAD/somefolder/README.md#L63-L64",
+		"generic-api-key",
+		"empty_org",
+	}
+	for _, w := range wanted {
+		if !strings.Contains(html, w) {
+			t.Errorf("html output is missing %q", w)
+		}
+	}
+	// only the first 10 chars of the secret should be in the report
+	if strings.Contains(html, "DEADBEEFDEADBEEFDEADBEEFDEADBEEFDEADBEEF") {
+		t.Errorf("html output contains the full secret")
+	}
+	if strings.Contains(html, "https://cdn") {
+		t.Errorf("html output should be self contained")
+	}
+}
+
+func TestBuildHtmlReportSummary(t *testing.T) {
+	results := []GitleaksRepoResult{
+		getRepoResult(),
+		{Repository: "clean", Org: "org", URL: "https://github.com/org/clean"},
+		{Repository: "broken", Org: "org", URL: "https://github.com/org/broken", Err: fmt.Errorf("clone failed")},
+	}
+	report := build_html_report(results, []string{"org"})
+	if report.TotalRepos != 3 {
+		t.Errorf("wanted 3 repos, got %d", report.TotalRepos)
+	}
+	if report.ReposWithFindings != 1 {
+		t.Errorf("wanted 1 repo with findings, got %d", report.ReposWithFindings)
+	}
+	if report.TotalFindings != 1 {
+		t.Errorf("wanted 1 finding, got %d", report.TotalFindings)
+	}
+	if report.Errors != 1 {
+		t.Errorf("wanted 1 error, got %d", report.Errors)
+	}
+}
+
+func TestPermalinks(t *testing.T) {
+	finding := GitleaksResult{File: "some dir/app.yml", Commit: "abc123", StartLine: 3, EndLine: 5}
+	tests := []struct {
+		provider string
+		url      string
+		commit   string
+		file     string
+	}{
+		{"GITHUB", "https://github.com/org/repo", "https://github.com/org/repo/commit/abc123",
+			"https://github.com/org/repo/blob/abc123/some%20dir/app.yml#L3-L5"},
+		{"GITLAB", "https://gitlab.com/group/repo/", "https://gitlab.com/group/repo/commit/abc123",
+			"https://gitlab.com/group/repo/blob/abc123/some%20dir/app.yml#L3-L5"},
+		{"BITBUCKET", "https://bitbucket.org/ws/repo", "https://bitbucket.org/ws/repo/commits/abc123",
+			"https://bitbucket.org/ws/repo/src/abc123/some%20dir/app.yml#lines-3:5"},
+		{"BITBUCKET", "https://git.example.com/projects/KEY/repos/repo", "https://git.example.com/projects/KEY/repos/repo/commits/abc123",
+			"https://git.example.com/projects/KEY/repos/repo/browse/some%20dir/app.yml?at=abc123#3-5"},
+		{"GITEA", "https://gitea.example.com/org/repo", "https://gitea.example.com/org/repo/commit/abc123",
+			"https://gitea.example.com/org/repo/src/commit/abc123/some%20dir/app.yml#L3-L5"},
+		{"AZURE_DEVOPS", "https://dev.azure.com/org/proj/_git/repo", "https://dev.azure.com/org/proj/_git/repo/commit/abc123",
+			"https://dev.azure.com/org/proj/_git/repo?path=%2Fsome+dir%2Fapp.yml&version=GCabc123&line=3&lineEnd=6&lineStartColumn=1&lineEndColumn=1"},
+		{"GIT", "git@example.com:org/repo.git", "", ""},
+	}
+	for _, tt := range tests {
+		if got := commit_permalink(tt.provider, tt.url, finding.Commit); got != tt.commit {
+			t.Errorf("%s commit link: got %s, wanted %s", tt.provider, got, tt.commit)
+		}
+		if got := file_permalink(tt.provider, tt.url, finding); got != tt.file {
+			t.Errorf("%s file link: got %s, wanted %s", tt.provider, got, tt.file)
+		}
+	}
+	if got := commit_link_markdown("GIT", "git@example.com:org/repo.git", finding.Commit); got != "abc123" {
+		t.Errorf("repos without a web UI should get a bare commit, got %s", got)
+	}
+}
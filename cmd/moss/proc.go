@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// running_cmds are the commands started with start_cmd that haven't been
+// waited on yet, keyed by pid
+var running_cmds sync.Map
+
+// temp_dirs are the scan temp dirs that haven't been removed yet
+var temp_dirs sync.Map
+
+// start_cmd starts cmd and tracks it until wait_cmd, so abort_scans can kill
+// it if moss has to exit before it finishes
+func start_cmd(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	running_cmds.Store(cmd.Process.Pid, cmd.Process)
+	return nil
+}
+
+func wait_cmd(cmd *exec.Cmd) error {
+	defer running_cmds.Delete(cmd.Process.Pid)
+	return cmd.Wait()
+}
+
+// run_cmd is cmd.Run for commands abort_scans should know about
+func run_cmd(cmd *exec.Cmd) error {
+	if err := start_cmd(cmd); err != nil {
+		return err
+	}
+	return wait_cmd(cmd)
+}
+
+// abort_scans kills every running command along with the processes it
+// started and removes the scans' temp dirs, for when moss exits without
+// waiting for the scans to wind down
+func abort_scans() {
+	running_cmds.Range(func(_, p any) bool {
+		kill_process_group(p.(*os.Process))
+		return true
+	})
+	temp_dirs.Range(func(dir, _ any) bool {
+		os.RemoveAll(dir.(string))
+		return true
+	})
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// kill_on_cancel only kills the command itself, children that keep its
+// output open are given up on after kill_wait_delay
+func kill_on_cancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = kill_wait_delay
+}
+
+func kill_process_group(p *os.Process) error {
+	return p.Kill()
+}
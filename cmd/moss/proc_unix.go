@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// kill_on_cancel makes a command context kill the command along with every
+// process it started, like the helpers git runs for a clone. The command
+// gets its own process group, so a Ctrl-C in the terminal doesn't reach it
+// and moss decides when it's killed.
+func kill_on_cancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return kill_process_group(cmd.Process)
+	}
+	cmd.WaitDelay = kill_wait_delay
+}
+
+// kill_process_group kills a process started by kill_on_cancel and its
+// children
+func kill_process_group(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// redaction modes, see ConfOutput.Redaction
+const (
+	redact_none    = "none"
+	redact_partial = "partial"
+	redact_full    = "full"
+	redact_hash    = "hash"
+)
+
+const default_redaction_prefix = 4
+
+const redacted_placeholder = "REDACTED"
+
+// setup_redaction checks the redaction policy, mode overrides the config.
+// Without one secrets are reported as they were before redaction existed.
+func (c *Conf) setup_redaction(mode string) error {
+	if mode != "" {
+		c.Output.Redaction = mode
+	}
+	c.Output.Redaction = strings.ToLower(c.Output.Redaction)
+	switch c.Output.Redaction {
+	case "", redact_none, redact_partial, redact_full:
+	case redact_hash:
+		// a random salt would make the hashes shown useless outside this run
+		if c.SecretHashSalt == "" {
+			return fmt.Errorf("hash redaction needs secret_hash_salt or MOSS_SECRET_SALT set")
+		}
+	default:
+		return fmt.Errorf("unknown redaction %q, expected none, partial, full or hash", c.Output.Redaction)
+	}
+	if c.Output.RedactionPrefix < 0 {
+		return fmt.Errorf("redaction_prefix can't be negative")
+	}
+	if c.Output.RedactionPrefix == 0 {
+		c.Output.RedactionPrefix = default_redaction_prefix
+	}
+	return nil
+}
+
+// redact_value applies the policy to a single value. Partial redaction
+// never shows more than half of a value, so short secrets aren't given away.
+func (o ConfOutput) redact_value(value string, hash string) string {
+	if value == "" {
+		return ""
+	}
+	switch o.Redaction {
+	case "", redact_none:
+		return value
+	case redact_full:
+		return redacted_placeholder
+	case redact_hash:
+		return "sha256:" + hash
+	}
+	prefix := o.RedactionPrefix
+	if prefix > len(value)/2 {
+		prefix = len(value) / 2
+	}
+	return value[:prefix] + "..."
+}
+
+// redact_finding redacts the secret and the match it was found in. The
+// secret's hash and the fingerprint don't depend on it, so redacted
+// findings still dedup and match baselines.
+func (o ConfOutput) redact_finding(f GitleaksResult) GitleaksResult {
+	f.Redaction = o.Redaction
+	if o.Redaction == "" || o.Redaction == redact_none {
+		return f
+	}
+	secret := o.redact_value(f.Secret, f.SecretHash)
+	if f.Secret != "" && strings.Contains(f.Match, f.Secret) {
+		f.Match = strings.ReplaceAll(f.Match, f.Secret, secret)
+	} else {
+		// without the secret to find in the match, all of it is sensitive
+		f.Match = o.redact_value(f.Match, f.SecretHash)
+	}
+	f.Secret = secret
+	return f
+}
+
+// redact_ignores returns a copy of the expiring ignores with the values of
+// ignore_secrets entries redacted, they're secrets too. Patterns, commits
+// and paths are shown in full.
+func (o ConfOutput) redact_ignores(expiring []ExpiringIgnore, salt string) []ExpiringIgnore {
+	redacted := make([]ExpiringIgnore, 0, len(expiring))
+	for _, e := range expiring {
+		if e.List == "ignore_secrets" {
+			e.Value = o.redact_value(e.Value, secret_hash(salt, e.Value))
+		}
+		redacted = append(redacted, e)
+	}
+	return redacted
+}
+
+// redact_results returns a redacted copy of the results for output
+func (o ConfOutput) redact_results(results []GitleaksRepoResult) []GitleaksRepoResult {
+	redacted := make([]GitleaksRepoResult, 0, len(results))
+	for _, r := range results {
+		findings := make([]GitleaksResult, 0, len(r.Results))
+		for _, f := range r.Results {
+			findings = append(findings, o.redact_finding(f))
+		}
+		r.Results = findings
+		if r.Suppressed != nil {
+			suppressed := make([]GitleaksResult, 0, len(r.Suppressed))
+			for _, f := range r.Suppressed {
+				suppressed = append(suppressed, o.redact_finding(f))
+			}
+			r.Suppressed = suppressed
+		}
+		redacted = append(redacted, r)
+	}
+	return redacted
+}
+
+// display_secret is the secret shown in reports. Findings that haven't been
+// through a redaction policy only have their first 10 characters shown.
+func display_secret(f GitleaksResult) string {
+	if f.Redaction == "" && len(f.Secret) > 10 {
+		return f.Secret[:10]
+	}
+	return f.Secret
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetupRedaction(t *testing.T) {
+	conf := Conf{}
+	if err := conf.setup_redaction(""); err != nil || conf.Output.Redaction != "" || conf.Output.RedactionPrefix != default_redaction_prefix {
+		t.Errorf("unexpected defaults %+v, %v", conf.Output, err)
+	}
+	if err := conf.setup_redaction("HASH"); err == nil {
+		t.Error("hash redaction without a configured salt should be an error")
+	}
+	conf.SecretHashSalt = "salt"
+	if err := conf.setup_redaction("HASH"); err != nil || conf.Output.Redaction != redact_hash {
+		t.Errorf("flag should override the config, got %q, %v", conf.Output.Redaction, err)
+	}
+	if err := conf.setup_redaction("bogus"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestRedactResults(t *testing.T) {
+	repo := getRepoResult()
+	repo.Suppressed = []GitleaksResult{repo.Results[0]}
+	repo.Suppressed[0].Suppression = &Suppression{Kind: suppression_inline}
+	repo.hashSecrets("salt")
+	secret := repo.Results[0].Secret
+	fingerprint := repo.Results[0].fingerprint(repo.URL)
+
+	tests := []struct {
+		mode   string
+		secret string
+		match  string
+	}{
+		{redact_none, secret, "Keygrip = " + secret},
+		{redact_partial, "DEAD...", "Keygrip = DEAD..."},
+		{redact_full, redacted_placeholder, "Keygrip = " + redacted_placeholder},
+		{redact_hash, "sha256:" + repo.Results[0].SecretHash, "Keygrip = sha256:" + repo.Results[0].SecretHash},
+	}
+	for _, tt := range tests {
+		out := ConfOutput{Redaction: tt.mode, RedactionPrefix: 4}.redact_results([]GitleaksRepoResult{repo})
+		for _, f := range append(out[0].Results, out[0].Suppressed...) {
+			if f.Secret != tt.secret || f.Match != tt.match {
+				t.Errorf("%s: got secret %q match %q", tt.mode, f.Secret, f.Match)
+			}
+			if f.fingerprint(repo.URL) != fingerprint || f.SecretHash != repo.Results[0].SecretHash {
+				t.Errorf("%s: redaction changed the fingerprint or hash", tt.mode)
+			}
+		}
+		if md := markdown_output(out, []string{"org"}); !strings.Contains(md, "|"+tt.secret+"|") {
+			t.Errorf("%s: markdown doesn't show the redacted secret", tt.mode)
+		}
+		if tt.mode != redact_none && strings.Contains(json_output(out, []string{"org"}), secret) {
+			t.Errorf("%s: json output contains the secret", tt.mode)
+		}
+	}
+	if repo.Results[0].Secret != secret {
+		t.Error("redacting modified the original results")
+	}
+	// without a policy the json output is what it was before redaction
+	out := ConfOutput{}.redact_results([]GitleaksRepoResult{repo})
+	if f := out[0].Results[0]; f.Secret != secret || f.Redaction != "" || strings.Contains(json_output(out, []string{"org"}), `"Redaction"`) {
+		t.Errorf("unset redaction changed the findings: %+v", f)
+	}
+}
+
+func TestPartialRedactionOfShortSecrets(t *testing.T) {
+	o := ConfOutput{Redaction: redact_partial, RedactionPrefix: 10}
+	if got := o.redact_value("hunter2", ""); got != "hun..." {
+		t.Errorf("expected at most half of a short secret, got %q", got)
+	}
+}
+
+func TestRedactIgnores(t *testing.T) {
+	expiring := []ExpiringIgnore{
+		{List: "ignore_secrets", Value: "abcdefghijkl"},
+		{List: "ignore_commits", Value: "c0a4e7c1208fb49c28b2979fe68985ddac696a6e"},
+	}
+	full := ConfOutput{Redaction: redact_full}.redact_ignores(expiring, "salt")
+	if full[0].Value != redacted_placeholder || full[1].Value != expiring[1].Value {
+		t.Errorf("only ignored secrets should be redacted, got %+v", full)
+	}
+	hashed := ConfOutput{Redaction: redact_hash}.redact_ignores(expiring, "salt")
+	if hashed[0].Value != "sha256:"+secret_hash("salt", "abcdefghijkl") {
+		t.Errorf("expected the secret's hash, got %s", hashed[0].Value)
+	}
+	if expiring[0].Value != "abcdefghijkl" {
+		t.Error("the entries passed in shouldn't be changed")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v47/github"
+	"github.com/rs/zerolog/log"
+	"github.com/xanzy/go-gitlab"
+)
+
+// api_retry is the retry policy for provider API calls, set from the config
+// in main. The zero policy makes a single attempt.
+var api_retry RetryPolicy
+
+// default retry policies, used for anything left unset in the config
+var (
+	default_clone_retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: "2s", MaxBackoff: "30s"}
+	default_api_retry   = RetryPolicy{MaxAttempts: 4, InitialBackoff: "1s", MaxBackoff: "30s"}
+	default_scan_retry  = RetryPolicy{MaxAttempts: 2, InitialBackoff: "5s", MaxBackoff: "30s"}
+)
+
+// git_transient_errors are bits of git's stderr that mean the network or the
+// server had a problem, rather than the repo missing or auth failing
+var git_transient_errors = []string{
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"connection timed out",
+	"operation timed out",
+	"connection reset",
+	"connection refused",
+	"early eof",
+	"the remote end hung up unexpectedly",
+	"rpc failed",
+	"unexpected disconnect",
+	"gnutls_handshake",
+	"returned error: 429",
+	"returned error: 5",
+}
+
+// parse_retry_policies fills in the defaults and parses the backoffs
+func (c *Conf) parse_retry_policies() error {
+	policies := []struct {
+		name     string
+		policy   *RetryPolicy
+		defaults RetryPolicy
+	}{
+		{"clone", &c.Retry.Clone, default_clone_retry},
+		{"api", &c.Retry.API, default_api_retry},
+		{"scan", &c.Retry.Scan, default_scan_retry},
+	}
+	for _, p := range policies {
+		if err := p.policy.parse("retry."+p.name, p.defaults); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *RetryPolicy) parse(name string, defaults RetryPolicy) error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("%s.max_attempts can't be negative", name)
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.InitialBackoff == "" {
+		p.InitialBackoff = defaults.InitialBackoff
+	}
+	if p.MaxBackoff == "" {
+		p.MaxBackoff = defaults.MaxBackoff
+	}
+	var err error
+	if p.initial_backoff, err = parse_timeout(name+".initial_backoff", p.InitialBackoff); err != nil {
+		return err
+	}
+	if p.max_backoff, err = parse_timeout(name+".max_backoff", p.MaxBackoff); err != nil {
+		return err
+	}
+	if p.max_backoff < p.initial_backoff {
+		return fmt.Errorf("%s.max_backoff is shorter than initial_backoff", name)
+	}
+	return nil
+}
+
+// backoff is how long to wait after the given failed attempt: it doubles
+// each attempt up to max_backoff, with the upper half jittered so retries
+// from concurrent scans spread out
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.initial_backoff
+	for i := 1; i < attempt && d < p.max_backoff; i++ {
+		d *= 2
+	}
+	if d > p.max_backoff {
+		d = p.max_backoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// do calls fn until it succeeds, fails with an error that isn't retryable,
+// runs out of attempts or ctx is done, and returns how many attempts it made
+// along with fn's last error
+func (p RetryPolicy) do(ctx context.Context, what string, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= p.MaxAttempts {
+			return attempt, err
+		}
+		retry, after := is_retryable(err)
+		if !retry {
+			return attempt, err
+		}
+		wait := p.backoff(attempt)
+		if after > wait {
+			// rate limits can reset far in the future, there's no point
+			// holding a scan slot that long
+			if after > p.max_backoff {
+				log.Warn().Err(err).Str("op", what).Dur("retry_after", after).Msg("not retrying, asked to wait longer than max_backoff")
+				return attempt, err
+			}
+			wait = after
+		}
+		log.Warn().Err(err).Str("op", what).Int("attempt", attempt).Dur("wait", wait).Msg("transient failure, retrying")
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// is_retryable reports whether err is likely to go away on its own: network
+// timeouts, 5xx responses and rate limits are, while 404s, auth failures and
+// everything unrecognised aren't. It also returns how long the server asked
+// to be left alone for, if it did.
+func is_retryable(err error) (bool, time.Duration) {
+	var api_err *apiError
+	var gh_rate *github.RateLimitError
+	var gh_abuse *github.AbuseRateLimitError
+	var gh_err *github.ErrorResponse
+	var gl_err *gitlab.ErrorResponse
+	var exit_err *exec.ExitError
+	var dns_err *net.DNSError
+	var op_err *net.OpError
+	var net_err net.Error
+	switch {
+	case errors.As(err, &api_err):
+		return retryable_status(api_err.StatusCode), api_err.RetryAfter
+	case errors.As(err, &gh_rate):
+		return true, time.Until(gh_rate.Rate.Reset.Time)
+	case errors.As(err, &gh_abuse):
+		if gh_abuse.RetryAfter != nil {
+			return true, *gh_abuse.RetryAfter
+		}
+		return true, 0
+	case errors.As(err, &gh_err):
+		return retryable_response(gh_err.Response)
+	case errors.As(err, &gl_err):
+		return retryable_response(gl_err.Response)
+	case errors.As(err, &dns_err):
+		return !dns_err.IsNotFound, 0
+	case errors.As(err, &op_err):
+		return true, 0
+	case errors.As(err, &net_err) && net_err.Timeout():
+		return true, 0
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return true, 0
+	case errors.As(err, &exit_err) && exit_err.ProcessState != nil && !exit_err.Exited():
+		// killed by a signal we didn't send, e.g. the OOM killer
+		return true, 0
+	}
+	msg := strings.ToLower(err.Error())
+	for _, transient := range git_transient_errors {
+		if strings.Contains(msg, transient) {
+			return true, 0
+		}
+	}
+	return false, 0
+}
+
+func retryable_status(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+func retryable_response(resp *http.Response) (bool, time.Duration) {
+	if resp == nil {
+		return false, 0
+	}
+	return retryable_status(resp.StatusCode), retry_after(resp)
+}
+
+// retry_after reads the Retry-After header, in seconds or as a date
+func retry_after(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v47/github"
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/sync/semaphore"
+)
+
+// fastRetry is a policy that retries without waiting long
+func fastRetry(t *testing.T, attempts int) RetryPolicy {
+	p := RetryPolicy{MaxAttempts: attempts, InitialBackoff: "1ms", MaxBackoff: "2ms"}
+	if err := p.parse("test", RetryPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseRetryPolicies(t *testing.T) {
+	conf := Conf{Retry: ConfRetry{Scan: RetryPolicy{MaxAttempts: 1}}}
+	if err := conf.parse_retry_policies(); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Retry.Clone.MaxAttempts != 3 || conf.Retry.Clone.initial_backoff != 2*time.Second || conf.Retry.API.max_backoff != 30*time.Second {
+		t.Errorf("defaults weren't applied: %+v", conf.Retry)
+	}
+	if conf.Retry.Scan.MaxAttempts != 1 {
+		t.Errorf("configured max_attempts was overridden: %+v", conf.Retry.Scan)
+	}
+	for _, bad := range []RetryPolicy{{MaxAttempts: -1}, {InitialBackoff: "soon"}, {InitialBackoff: "1m", MaxBackoff: "1s"}} {
+		if err := (&Conf{Retry: ConfRetry{API: bad}}).parse_retry_policies(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	response := func(code int) *http.Response {
+		return &http.Response{StatusCode: code, Header: http.Header{}, Request: &http.Request{}}
+	}
+	limited := response(429)
+	limited.Header.Set("Retry-After", "7")
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"api 502", &apiError{StatusCode: 502}, true},
+		{"api 404", &apiError{StatusCode: 404}, false},
+		{"api 401", &apiError{StatusCode: 401}, false},
+		{"github 503", &github.ErrorResponse{Response: response(503)}, true},
+		{"github 403", &github.ErrorResponse{Response: response(403)}, false},
+		{"github rate limit", &github.RateLimitError{Response: response(403)}, true},
+		{"gitlab 500", &gitlab.ErrorResponse{Response: response(500)}, true},
+		{"gitlab 404", &gitlab.ErrorResponse{Response: response(404)}, false},
+		{"git dns", errors.New("git clone: exit status 128: fatal: unable to access 'https://example.com/': Could not resolve host: example.com"), true},
+		{"git 502", errors.New("git clone: exit status 128: error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502"), true},
+		{"git auth", errors.New("git clone: exit status 128: fatal: Authentication failed for 'https://example.com/'"), false},
+		{"git not found", errors.New("git clone: exit status 128: remote: Repository not found."), false},
+	}
+	for _, tt := range tests {
+		if retry, _ := is_retryable(tt.err); retry != tt.retry {
+			t.Errorf("%s: expected retryable %v", tt.name, tt.retry)
+		}
+	}
+	if _, after := is_retryable(&gitlab.ErrorResponse{Response: limited}); after != 7*time.Second {
+		t.Errorf("Retry-After wasn't read, got %s", after)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	transient := &apiError{StatusCode: 503}
+	calls := 0
+	attempts, err := fastRetry(t, 3).do(context.Background(), "test", func() error {
+		calls++
+		if calls < 2 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("expected success on the second attempt, got %d %v", attempts, err)
+	}
+
+	calls = 0
+	attempts, _ = fastRetry(t, 3).do(context.Background(), "test", func() error { calls++; return transient })
+	if attempts != 3 || calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	attempts, _ = fastRetry(t, 3).do(context.Background(), "test", func() error { return &apiError{StatusCode: 404} })
+	if attempts != 1 {
+		t.Errorf("permanent errors shouldn't be retried, got %d attempts", attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts, _ = fastRetry(t, 3).do(ctx, "test", func() error { cancel(); return transient })
+	if attempts != 1 {
+		t.Errorf("canceled work shouldn't be retried, got %d attempts", attempts)
+	}
+
+	// a zero policy makes one attempt
+	attempts, _ = RetryPolicy{}.do(context.Background(), "test", func() error { return transient })
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+}
+
+func TestGetJSONRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case calls == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"ok": true}`))
+		}
+	}))
+	defer server.Close()
+	defer func(p RetryPolicy) { api_retry = p }(api_retry)
+	api_retry = fastRetry(t, 3)
+
+	var out struct{ OK bool }
+	if _, err := get_json(context.Background(), server.URL+"/flaky", nil, &out); err != nil || !out.OK || calls != 2 {
+		t.Errorf("expected the 502 to be retried, got %d calls, %v", calls, err)
+	}
+	calls = 0
+	if _, err := get_json(context.Background(), server.URL+"/missing", nil, &out); err == nil || calls != 1 {
+		t.Errorf("expected the 404 to fail without a retry, got %d calls, %v", calls, err)
+	}
+}
+
+func TestScanRepoRetriesCrashedScanner(t *testing.T) {
+	// the fake gitleaks is killed the first time it runs, like it would be
+	// by the OOM killer, and reports nothing the second time
+	bin := t.TempDir()
+	marker := filepath.Join(bin, "crashed")
+	script := `
+for arg in "$@"; do
+  case "$arg" in
+    -r=*) report="${arg#-r=}" ;;
+  esac
+done
+if [ ! -f "` + marker + `" ]; then
+  touch "` + marker + `"
+  kill -9 $$
+fi
+echo "[]" > "$report"
+`
+	if err := os.WriteFile(filepath.Join(bin, "gitleaks"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	repo := &GitRepo{Name: "repo", HTMLURL: "repo", CloneURL: gitRepoWithCommit(t), orgname: "local"}
+	conf := Conf{Retry: ConfRetry{Clone: fastRetry(t, 3), Scan: fastRetry(t, 2)}}
+	result := scan_repo_result(context.Background(), repo, "gitleaks.toml", conf, semaphore.NewWeighted(1))
+	if result.Err != nil || result.CloneAttempts != 1 || result.ScanAttempts != 2 {
+		t.Errorf("expected the scan to succeed on its second attempt, got %+v", result)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const suppression_rule = "rule"
+
+// stringList is a config value that's either a single string or a list
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+type ruleRange struct {
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+}
+
+type ruleDates struct {
+	After  string `yaml:"after"`
+	Before string `yaml:"before"`
+}
+
+// SuppressionRule suppresses the findings matching all of its conditions.
+// Each condition is optional, and a list matches if any of its values do.
+type SuppressionRule struct {
+	Name string `yaml:"name"`
+	// RuleID, Author, Email and Org are globs
+	RuleID stringList `yaml:"rule_id"`
+	Author stringList `yaml:"author"`
+	Email  stringList `yaml:"email"`
+	Org    stringList `yaml:"org"`
+	// File is a path glob, ** matches any number of directories
+	File stringList `yaml:"file"`
+	// Repo globs match the repo name, or org/repo if they contain a /
+	Repo    stringList `yaml:"repo"`
+	Entropy *ruleRange `yaml:"entropy"`
+	Date    *ruleDates `yaml:"date"`
+	Reason  string     `yaml:"reason"`
+	Owner   string     `yaml:"owner"`
+	Expires string     `yaml:"expires"`
+}
+
+// label names a rule in logs and reports, unnamed rules go by position
+func (r SuppressionRule) label(index int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// suppressionMatcher is a SuppressionRule compiled for matching
+type suppressionMatcher struct {
+	rule    SuppressionRule
+	rule_id []*regexp.Regexp
+	author  []*regexp.Regexp
+	email   []*regexp.Regexp
+	org     []*regexp.Regexp
+	file    []*regexp.Regexp
+	repo    []*regexp.Regexp
+	after   time.Time
+	before  time.Time
+}
+
+// glob_to_regexp compiles a glob where * and ? don't cross a / and **
+// matches across directories
+func glob_to_regexp(glob string, fold_case bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if fold_case {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated [ in glob %q", glob)
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func compile_globs(globs stringList, fold_case bool) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0)
+	for _, glob := range globs {
+		re, err := glob_to_regexp(glob, fold_case)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// parse_rule_date accepts a day or a full RFC3339 timestamp
+func parse_rule_date(date string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, date)
+}
+
+func compile_suppression_rule(rule SuppressionRule) (*suppressionMatcher, error) {
+	m := &suppressionMatcher{rule: rule}
+	var err error
+	if m.rule_id, err = compile_globs(rule.RuleID, false); err != nil {
+		return nil, err
+	}
+	if m.author, err = compile_globs(rule.Author, true); err != nil {
+		return nil, err
+	}
+	if m.email, err = compile_globs(rule.Email, true); err != nil {
+		return nil, err
+	}
+	if m.org, err = compile_globs(rule.Org, false); err != nil {
+		return nil, err
+	}
+	if m.file, err = compile_globs(rule.File, false); err != nil {
+		return nil, err
+	}
+	if m.repo, err = compile_globs(rule.Repo, false); err != nil {
+		return nil, err
+	}
+	if rule.Date != nil {
+		if rule.Date.After != "" {
+			if m.after, err = parse_rule_date(rule.Date.After); err != nil {
+				return nil, fmt.Errorf("invalid date.after: %w", err)
+			}
+		}
+		if rule.Date.Before != "" {
+			if m.before, err = parse_rule_date(rule.Date.Before); err != nil {
+				return nil, fmt.Errorf("invalid date.before: %w", err)
+			}
+		}
+	}
+	has_entropy := rule.Entropy != nil && (rule.Entropy.Min != nil || rule.Entropy.Max != nil)
+	has_date := !m.after.IsZero() || !m.before.IsZero()
+	if len(m.rule_id)+len(m.author)+len(m.email)+len(m.org)+len(m.file)+len(m.repo) == 0 && !has_entropy && !has_date {
+		return nil, fmt.Errorf("rule has no conditions and would suppress every finding")
+	}
+	return m, nil
+}
+
+func match_any(res []*regexp.Regexp, value string) bool {
+	if len(res) == 0 {
+		return true
+	}
+	for _, re := range res {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a finding meets every condition of the rule
+func (m *suppressionMatcher) matches(org string, repo string, f GitleaksResult) bool {
+	if !match_any(m.rule_id, f.RuleID) || !match_any(m.author, f.Author) || !match_any(m.email, f.Email) ||
+		!match_any(m.org, org) || !match_any(m.file, f.File) {
+		return false
+	}
+	if len(m.repo) > 0 {
+		matched := false
+		for i, re := range m.repo {
+			target := repo
+			if strings.Contains(m.rule.Repo[i], "/") {
+				target = org + "/" + repo
+			}
+			if re.MatchString(target) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if e := m.rule.Entropy; e != nil {
+		if e.Min != nil && float64(f.Entropy) < *e.Min {
+			return false
+		}
+		if e.Max != nil && float64(f.Entropy) > *e.Max {
+			return false
+		}
+	}
+	if !m.after.IsZero() || !m.before.IsZero() {
+		date, err := parse_finding_date(f.Date)
+		if err != nil {
+			return false
+		}
+		if !m.after.IsZero() && date.Before(m.after) {
+			return false
+		}
+		if !m.before.IsZero() && !date.Before(m.before) {
+			return false
+		}
+	}
+	return true
+}
+
+// suppression returns what's recorded on findings the rule suppresses
+func (m *suppressionMatcher) suppression() *Suppression {
+	reason := m.rule.Reason
+	if m.rule.Name != "" && reason != "" {
+		reason = fmt.Sprintf("%s: %s", m.rule.Name, reason)
+	} else if reason == "" {
+		reason = m.rule.Name
+	}
+	return &Suppression{Kind: suppression_rule, Reason: reason, Expires: m.rule.Expires}
+}
+
+// buildSuppressionRules compiles the suppression rules, skipping invalid
+// and expired ones
+func (c *Conf) buildSuppressionRules() {
+	now := time.Now()
+	matchers := make([]*suppressionMatcher, 0)
+	for i, rule := range c.SuppressionRules {
+		name := rule.label(i)
+		if suppression_expired(rule.Expires, now) {
+			continue
+		}
+		m, err := compile_suppression_rule(rule)
+		if err != nil {
+			log.Warn().Err(err).Str("rule", name).Msg("invalid suppression rule, skipping")
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	c.suppression_rules = matchers
+}
+
+// filterRules moves findings matching a suppression rule to the suppressed list
+func (r *GitleaksRepoResult) filterRules(rules []*suppressionMatcher) {
+	if len(rules) == 0 {
+		return
+	}
+	kept := make([]GitleaksResult, 0)
+	for _, result := range r.Results {
+		suppressed := false
+		for _, rule := range rules {
+			if rule.matches(r.Org, r.Repository, result) {
+				result.Suppression = rule.suppression()
+				r.Suppressed = append(r.Suppressed, result)
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, result)
+		}
+	}
+	r.Results = kept
+}
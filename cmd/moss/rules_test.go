@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	cases := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"**/testdata/**", "testdata/keys.pem", true},
+		{"**/testdata/**", "pkg/a/testdata/keys.pem", true},
+		{"**/testdata/**", "pkg/testdatab/keys.pem", false},
+		{"*.pem", "keys.pem", true},
+		{"*.pem", "certs/keys.pem", false},
+		{"docs/?.md", "docs/a.md", true},
+		{"[!a]*.go", "main.go", true},
+		{"[!a]*.go", "api.go", false},
+		{"config.(yml)", "config.(yml)", true},
+	}
+	for _, c := range cases {
+		re, err := glob_to_regexp(c.glob, false)
+		if err != nil {
+			t.Fatalf("%s failed to compile: %v", c.glob, err)
+		}
+		if re.MatchString(c.path) != c.match {
+			t.Errorf("%s matching %s should be %v", c.glob, c.path, c.match)
+		}
+	}
+	if _, err := glob_to_regexp("[abc", false); err == nil {
+		t.Errorf("unterminated classes should fail")
+	}
+}
+
+func TestSuppressionRules(t *testing.T) {
+	config := `
+suppression_rules:
+  - name: testdata
+    rule_id: generic-api-key
+    file: '**/testdata/**'
+    org: org
+    reason: fixtures
+  - name: bots
+    email: ['*@bots.example.com']
+    repo: 'org/infra-*'
+  - name: low entropy before 2020
+    entropy: {max: 3.0}
+    date: {before: 2020-01-01}
+  - name: everything
+    reason: should be rejected
+  - name: expired
+    rule_id: '*'
+    expires: 2000-01-01
+`
+	var conf Conf
+	if err := yaml.Unmarshal([]byte(config), &conf); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	conf.buildSuppressionRules()
+	if len(conf.suppression_rules) != 3 {
+		t.Fatalf("rules without conditions and expired rules should be skipped, got %d", len(conf.suppression_rules))
+	}
+
+	base := getRepoResult().Results[0]
+	testdata := base
+	testdata.File = "pkg/parser/testdata/creds.json"
+	other_rule := testdata
+	other_rule.RuleID = "aws-access-token"
+	bot := base
+	bot.Email = "Deploy@Bots.Example.com"
+	old_low := base
+	old_low.Entropy = 2.5
+	old_low.Date = "2019-06-01T10:00:00Z"
+	new_low := old_low
+	new_low.Date = "2021-06-01T10:00:00Z"
+
+	infra := GitleaksRepoResult{Repository: "infra-prod", Org: "org", Results: []GitleaksResult{bot, testdata}}
+	infra.filterResults(conf)
+	if len(infra.Results) != 0 || len(infra.Suppressed) != 2 {
+		t.Errorf("bot and testdata findings should be suppressed in infra repos, got %+v", infra.Results)
+	}
+	if infra.Suppressed[1].Suppression.Reason != "testdata: fixtures" || infra.Suppressed[1].Suppression.Kind != suppression_rule {
+		t.Errorf("suppression wasn't recorded: %+v", infra.Suppressed[1].Suppression)
+	}
+
+	app := GitleaksRepoResult{Repository: "app", Org: "org", Results: []GitleaksResult{bot, other_rule, old_low, new_low}}
+	app.filterResults(conf)
+	if len(app.Results) != 3 || len(app.Suppressed) != 1 || app.Suppressed[0].Date != old_low.Date {
+		t.Errorf("only the old low entropy finding should be suppressed, got %+v", app.Suppressed)
+	}
+
+	// trufflehog dates saved by older runs still match date conditions
+	truffle_old := old_low
+	truffle_old.Date = "2019-06-01 12:00:00 +0200"
+	truffle_new := old_low
+	truffle_new.Date = "2021-06-01 12:00:00 +0200"
+	truffle := GitleaksRepoResult{Repository: "app", Org: "org", Results: []GitleaksResult{truffle_old, truffle_new}}
+	truffle.filterResults(conf)
+	if len(truffle.Results) != 1 || len(truffle.Suppressed) != 1 || truffle.Suppressed[0].Date != truffle_old.Date {
+		t.Errorf("trufflehog formatted dates should match date conditions, got %+v", truffle.Suppressed)
+	}
+
+	other_org := GitleaksRepoResult{Repository: "app", Org: "other", Results: []GitleaksResult{testdata}}
+	other_org.filterResults(conf)
+	if len(other_org.Results) != 1 {
+		t.Errorf("rules scoped to an org shouldn't apply to others")
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const sarif_schema = "https://json.schemastore.org/sarif-2.1.0.json"
+const sarif_version = "2.1.0"
+
+type sarifLog struct {
+	Schema     string                 `json:"$schema"`
+	Version    string                 `json:"version"`
+	Runs       []sarifRun             `json:"runs"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifRun struct {
+	Tool                     sarifTool              `json:"tool"`
+	AutomationDetails        sarifAutomationDetails `json:"automationDetails"`
+	VersionControlProvenance []sarifVersionControl  `json:"versionControlProvenance,omitempty"`
+	Invocations              []sarifInvocation      `json:"invocations,omitempty"`
+	Results                  []sarifResult          `json:"results"`
+	Properties               map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifAutomationDetails struct {
+	ID string `json:"id"`
+}
+
+type sarifVersionControl struct {
+	RepositoryURI string        `json:"repositoryUri"`
+	MappedTo      sarifArtifact `json:"mappedTo"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool                    `json:"executionSuccessful"`
+	ToolExecution       []sarifToolNotification `json:"toolExecutionNotifications,omitempty"`
+	Properties          map[string]interface{}  `json:"properties,omitempty"`
+}
+
+type sarifToolNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string             `json:"ruleId"`
+	RuleIndex           int                `json:"ruleIndex"`
+	Level               string             `json:"level"`
+	Message             sarifMessage       `json:"message"`
+	Locations           []sarifLocation    `json:"locations"`
+	PartialFingerprints map[string]string  `json:"partialFingerprints"`
+	BaselineState       string             `json:"baselineState,omitempty"`
+	Suppressions        []sarifSuppression `json:"suppressions,omitempty"`
+	Properties          map[string]string  `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI       string `json:"uri,omitempty"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarif_rules turns the gitleaks rule set into a SARIF rule catalog and an
+// index of rule id -> position in that catalog
+func sarif_rules(gl_conf *GitleaksToml) ([]sarifRule, map[string]int) {
+	rules := make([]sarifRule, 0)
+	index := make(map[string]int)
+	if gl_conf == nil {
+		return rules, index
+	}
+	for _, rule := range gl_conf.Rules {
+		if _, exists := index[rule.ID]; exists || rule.ID == "" {
+			continue
+		}
+		index[rule.ID] = len(rules)
+		rules = append(rules, sarifRule{
+			ID:               rule.ID,
+			Name:             rule.ID,
+			ShortDescription: sarifMessage{Text: rule.Description},
+		})
+	}
+	return rules, index
+}
+
+func sarif_region(finding GitleaksResult) sarifRegion {
+	region := sarifRegion{StartLine: finding.StartLine}
+	// SARIF lines and columns are 1 based
+	if region.StartLine < 1 {
+		region.StartLine = 1
+	}
+	if finding.StartColumn > 0 {
+		region.StartColumn = finding.StartColumn
+	}
+	if finding.EndLine >= region.StartLine {
+		region.EndLine = finding.EndLine
+	}
+	if finding.EndColumn > 0 {
+		region.EndColumn = finding.EndColumn
+	}
+	// a single line region can't end before it starts
+	if region.EndLine == region.StartLine && region.EndColumn != 0 && region.EndColumn < region.StartColumn {
+		region.EndColumn = 0
+	}
+	return region
+}
+
+// sarif_driver describes the scanner a repo was scanned with, and whether
+// its rules come from the gitleaks toml. Results from before the scanner was
+// recorded were all from gitleaks.
+func sarif_driver(scanner string) (sarifDriver, bool) {
+	switch scanner {
+	case "trufflehog":
+		return sarifDriver{Name: "trufflehog", InformationURI: "https://github.com/trufflesecurity/trufflehog"}, false
+	case "native":
+		return sarifDriver{Name: "moss", InformationURI: "https://github.com/livinginsyn/MOSS"}, true
+	}
+	return sarifDriver{Name: "gitleaks", InformationURI: "https://github.com/gitleaks/gitleaks"}, true
+}
+
+// sarif_base_id names the uriBaseId a repo's file paths are relative to
+func sarif_base_id(i int) string {
+	return fmt.Sprintf("REPO%d", i)
+}
+
+// build_sarif_run converts the results of an org's repos that were scanned
+// with the same scanner into a SARIF run. Each repo gets its own uriBaseId,
+// which versionControlProvenance maps to the repo.
+func build_sarif_run(org string, scanner string, repos []GitleaksRepoResult, gl_conf *GitleaksToml) sarifRun {
+	driver, uses_toml := sarif_driver(scanner)
+	if !uses_toml {
+		// trufflehog's detectors are listed as they show up in findings
+		gl_conf = nil
+	}
+	rules, index := sarif_rules(gl_conf)
+	run := sarifRun{
+		Tool: sarifTool{Driver: driver},
+		AutomationDetails: sarifAutomationDetails{
+			ID: fmt.Sprintf("moss/%s/%s/", org, driver.Name),
+		},
+		Results:    make([]sarifResult, 0),
+		Properties: map[string]interface{}{"org": org},
+	}
+	for i, repo_result := range repos {
+		base_id := sarif_base_id(i)
+		if repo_result.URL != "" {
+			run.VersionControlProvenance = append(run.VersionControlProvenance, sarifVersionControl{
+				RepositoryURI: repo_result.URL,
+				MappedTo:      sarifArtifact{URIBaseID: base_id},
+			})
+		}
+		invocation := sarifInvocation{
+			ExecutionSuccessful: repo_result.Err == nil,
+			Properties:          map[string]interface{}{"repository": repo_result.Repository, "private": repo_result.IsPrivate},
+		}
+		if repo_result.Err != nil {
+			invocation.ToolExecution = []sarifToolNotification{{
+				Level:   "error",
+				Message: sarifMessage{Text: repo_result.Err.Error()},
+			}}
+		}
+		run.Invocations = append(run.Invocations, invocation)
+		// suppressed findings are kept so viewers can show them as suppressed
+		findings := append(append([]GitleaksResult{}, repo_result.Results...), repo_result.Suppressed...)
+		for _, finding := range findings {
+			// findings from rules that aren't in the toml still need a catalog entry
+			rule_index, ok := index[finding.RuleID]
+			if !ok {
+				rule_index = len(rules)
+				index[finding.RuleID] = rule_index
+				rules = append(rules, sarifRule{
+					ID:               finding.RuleID,
+					Name:             finding.RuleID,
+					ShortDescription: sarifMessage{Text: finding.Description},
+				})
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    finding.RuleID,
+				RuleIndex: rule_index,
+				Level:     "error",
+				Message: sarifMessage{
+					Text: fmt.Sprintf("%s detected in %s/%s at commit %s", finding.Description, repo_result.Repository, finding.File, short_commit(finding.Commit)),
+				},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifact{URI: finding.File, URIBaseID: base_id},
+						Region:           sarif_region(finding),
+					},
+				}},
+				PartialFingerprints: map[string]string{
+					"mossFingerprint/v1": finding.fingerprint(repo_result.URL),
+					"commitSha":          finding.Commit,
+				},
+				BaselineState: sarif_baseline_state(finding.BaselineState),
+				Suppressions:  sarif_suppressions(finding),
+				Properties: map[string]string{
+					"repository": repo_result.Repository,
+					"commit":     finding.Commit,
+					"author":     finding.Author,
+					"email":      finding.Email,
+					"date":       finding.Date,
+					"commitUrl":  commit_permalink(repo_result.Provider, repo_result.URL, finding.Commit),
+					"secretHash": finding.SecretHash,
+				},
+			})
+		}
+	}
+	run.Tool.Driver.Rules = rules
+	return run
+}
+
+// sarif_suppressions marks suppressed findings, allow comments are
+// suppressions in the source in SARIF's terms
+func sarif_suppressions(finding GitleaksResult) []sarifSuppression {
+	if finding.Suppression == nil {
+		return nil
+	}
+	kind := "external"
+	if finding.Suppression.Kind == suppression_inline {
+		kind = "inSource"
+	}
+	return []sarifSuppression{{Kind: kind, Justification: finding.Suppression.Reason}}
+}
+
+// sarif_baseline_state maps a finding's baseline state to SARIF's
+func sarif_baseline_state(state string) string {
+	switch state {
+	case baseline_new:
+		return "new"
+	case baseline_existing:
+		return "unchanged"
+	}
+	return ""
+}
+
+// sarif_output renders the results as a SARIF 2.1.0 log with one run per org
+// and scanner, so the rule catalog is written once per run rather than once
+// per repo. Secrets found in more than one place are listed in the log's
+// properties.
+func sarif_output(results []GitleaksRepoResult, orgs []string, gl_conf *GitleaksToml, extras reportExtras) string {
+	json_res := get_json_obj(results, orgs)
+	s_log := sarifLog{
+		Schema:  sarif_schema,
+		Version: sarif_version,
+		Runs:    make([]sarifRun, 0),
+	}
+	for _, org := range orgs {
+		by_scanner := make(map[string][]GitleaksRepoResult)
+		scanners := make([]string, 0)
+		for _, repo_result := range json_res[org] {
+			driver, _ := sarif_driver(repo_result.Scanner)
+			if _, ok := by_scanner[driver.Name]; !ok {
+				scanners = append(scanners, driver.Name)
+			}
+			by_scanner[driver.Name] = append(by_scanner[driver.Name], repo_result)
+		}
+		for _, scanner := range scanners {
+			s_log.Runs = append(s_log.Runs, build_sarif_run(org, by_scanner[scanner][0].Scanner, by_scanner[scanner], gl_conf))
+		}
+	}
+	if len(extras.UniqueSecrets) > 0 {
+		s_log.Properties = map[string]interface{}{"mossUniqueSecrets": extras.UniqueSecrets}
+	}
+	s_string, err := json.Marshal(s_log)
+	if err != nil {
+		log.Fatal().Msg("Failed to marshal sarif results")
+	}
+	return string(s_string)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSarifOutput(t *testing.T) {
+	gl_conf := &GitleaksToml{Rules: []GitleaksRule{
+		{ID: "aws-access-token", Description: "AWS"},
+		{ID: "generic-api-key", Description: "Generic API Key"},
+	}}
+	results := []GitleaksRepoResult{
+		getRepoResult(),
+		{Repository: "broken", Org: "org", URL: "https://github.com/org/broken", Err: fmt.Errorf("clone failed")},
+	}
+	var s_log sarifLog
+	if err := json.Unmarshal([]byte(sarif_output(results, []string{"org"}, gl_conf, reportExtras{})), &s_log); err != nil {
+		t.Fatalf("sarif output isn't valid json: %v", err)
+	}
+	if s_log.Version != "2.1.0" {
+		t.Errorf("wrong sarif version %s", s_log.Version)
+	}
+	if len(s_log.Runs) != 1 {
+		t.Fatalf("wanted one run per org and scanner, got %d", len(s_log.Runs))
+	}
+	run := s_log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 {
+		t.Errorf("rule catalog should come from the toml, got %d rules", len(run.Tool.Driver.Rules))
+	}
+	if len(run.Results) != 1 {
+		t.Fatalf("wanted 1 result, got %d", len(run.Results))
+	}
+	res := run.Results[0]
+	if res.RuleID != "generic-api-key" || res.RuleIndex != 1 {
+		t.Errorf("wrong rule mapping %s/%d", res.RuleID, res.RuleIndex)
+	}
+	region := res.Locations[0].PhysicalLocation.Region
+	if region.StartLine != 63 || region.EndLine != 64 || region.StartColumn != 16 {
+		t.Errorf("wrong region %+v", region)
+	}
+	artifact := res.Locations[0].PhysicalLocation.ArtifactLocation
+	if artifact.URI != "somefolder/README.md" || artifact.URIBaseID != "REPO0" {
+		t.Errorf("wrong artifact location %+v", artifact)
+	}
+	// the result's base id maps back to its repo
+	if vcs := run.VersionControlProvenance; len(vcs) != 2 || vcs[0].MappedTo.URIBaseID != "REPO0" || vcs[0].RepositoryURI != "https://github.com/org/repo" {
+		t.Errorf("wrong version control provenance %+v", vcs)
+	}
+	if res.PartialFingerprints["mossFingerprint/v1"] == "" {
+		t.Errorf("missing partial fingerprint")
+	}
+	if len(run.Invocations) != 2 || !run.Invocations[0].ExecutionSuccessful || run.Invocations[1].ExecutionSuccessful {
+		t.Errorf("failed scans should be marked unsuccessful")
+	}
+}
+
+func TestSarifUnknownRule(t *testing.T) {
+	run := build_sarif_run("org", "gitleaks", []GitleaksRepoResult{getRepoResult()}, nil)
+	if len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].ID != "generic-api-key" {
+		t.Errorf("rules with findings should be added to the catalog")
+	}
+}
+
+func TestSarifDriverFollowsScanner(t *testing.T) {
+	gl_conf := &GitleaksToml{Rules: []GitleaksRule{
+		{ID: "aws-access-token", Description: "AWS"},
+		{ID: "generic-api-key", Description: "Generic API Key"},
+	}}
+	result := getRepoResult()
+	result.Scanner = "trufflehog"
+	run := build_sarif_run("org", result.Scanner, []GitleaksRepoResult{result}, gl_conf)
+	if run.Tool.Driver.Name != "trufflehog" || len(run.Tool.Driver.Rules) != 1 {
+		t.Errorf("trufflehog runs shouldn't use the gitleaks catalog, got %+v", run.Tool.Driver)
+	}
+	result.Scanner = "native"
+	if run := build_sarif_run("org", result.Scanner, []GitleaksRepoResult{result}, gl_conf); run.Tool.Driver.Name != "moss" || len(run.Tool.Driver.Rules) != 2 {
+		t.Errorf("native runs should use the gitleaks catalog, got %+v", run.Tool.Driver)
+	}
+	result.Scanner = ""
+	if run := build_sarif_run("org", result.Scanner, []GitleaksRepoResult{result}, gl_conf); run.Tool.Driver.Name != "gitleaks" {
+		t.Errorf("results without a scanner are from gitleaks, got %+v", run.Tool.Driver)
+	}
+}
+
+func TestSarifRunsPerOrgAndScanner(t *testing.T) {
+	gl_conf := &GitleaksToml{Rules: []GitleaksRule{{ID: "generic-api-key", Description: "Generic API Key"}}}
+	results := make([]GitleaksRepoResult, 0)
+	for i := 0; i < 50; i++ {
+		r := getRepoResult()
+		r.Repository = fmt.Sprintf("repo%d", i)
+		r.URL = "https://github.com/org/" + r.Repository
+		results = append(results, r)
+	}
+	truffle := getRepoResult()
+	truffle.Repository, truffle.Scanner = "truffled", "trufflehog"
+	other := getRepoResult()
+	other.Org = "other"
+	results = append(results, truffle, other)
+	var s_log sarifLog
+	if err := json.Unmarshal([]byte(sarif_output(results, []string{"org", "other"}, gl_conf, reportExtras{})), &s_log); err != nil {
+		t.Fatalf("sarif output isn't valid json: %v", err)
+	}
+	if len(s_log.Runs) != 3 {
+		t.Fatalf("wanted a run for each org and scanner, got %d", len(s_log.Runs))
+	}
+	gitleaks := s_log.Runs[0]
+	if gitleaks.Tool.Driver.Name != "gitleaks" || len(gitleaks.Results) != 50 || len(gitleaks.Tool.Driver.Rules) != 1 {
+		t.Errorf("gitleaks run is wrong: %s, %d results, %d rules", gitleaks.Tool.Driver.Name, len(gitleaks.Results), len(gitleaks.Tool.Driver.Rules))
+	}
+	if gitleaks.Results[49].Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID != "REPO49" || gitleaks.Results[49].Properties["repository"] != "repo49" {
+		t.Errorf("results should say which repo they're from: %+v", gitleaks.Results[49])
+	}
+	if s_log.Runs[1].Tool.Driver.Name != "trufflehog" || s_log.Runs[2].AutomationDetails.ID != "moss/other/gitleaks/" {
+		t.Errorf("runs are grouped wrong: %+v %+v", s_log.Runs[1].Tool.Driver, s_log.Runs[2].AutomationDetails)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const default_scanner = "gitleaks"
+
+// ScanRequest describes one repository for a Scanner to scan
+type ScanRequest struct {
+	Repo *GitRepo
+	// Dir is the repository to scan, a clone, mirror or local checkout
+	Dir string
+	// WorkDir is a scratch directory for reports, removed after the scan
+	WorkDir string
+	// LogOpts limits the scan to a range of commits, "" scans everything
+	LogOpts string
+}
+
+// Scanner is a secret detection backend. Every backend reports findings as
+// GitleaksResults, which is the finding model filters and outputs work on,
+// so detectors can be swapped without touching either.
+type Scanner interface {
+	Name() string
+	// SupportsLogOpts reports whether the scanner can limit a scan to a
+	// commit range, which incremental scanning needs
+	SupportsLogOpts() bool
+	// Scan scans a repo, stopping when ctx is done
+	Scan(ctx context.Context, req ScanRequest) ([]GitleaksResult, error)
+}
+
+// new_scanner builds the scanner called name from the config
+func new_scanner(name string, gl_conf_path string, conf Conf) (Scanner, error) {
+	switch strings.ToLower(name) {
+	case "", "gitleaks":
+		return &gitleaksScanner{
+			Binary:         "gitleaks",
+			ConfigPath:     gl_conf_path,
+			AdditionalArgs: conf.GitLeaksConfig.AdditionalArgs,
+		}, nil
+	case "trufflehog":
+		return &trufflehogScanner{
+			Binary:         "trufflehog",
+			AdditionalArgs: conf.TrufflehogConfig.AdditionalArgs,
+		}, nil
+	case "native":
+		return &nativeScanner{ConfigPath: gl_conf_path}, nil
+	}
+	return nil, fmt.Errorf("unknown scanner %q", name)
+}
+
+// scanner_name returns the scanner configured for a repo: its org's scanner
+// if set, otherwise the global one
+func scanner_name(repo *GitRepo, conf Conf) string {
+	if repo.scanner != "" {
+		return repo.scanner
+	}
+	if conf.Scanner != "" {
+		return conf.Scanner
+	}
+	return default_scanner
+}
+
+// validate_scanners makes sure every scanner named in the config exists
+func (c *Conf) validate_scanners() error {
+	names := []string{c.Scanner, c.LocalConfig.Scanner}
+	for _, orgs := range [][]OrgConfig{
+		c.GithubConfig.OrgsToScan,
+		c.GitlabConfig.OrgsToScan,
+		c.BitbucketConfig.OrgsToScan,
+		c.GiteaConfig.OrgsToScan,
+		c.AzureDevOpsConfig.OrgsToScan,
+	} {
+		for _, org := range orgs {
+			names = append(names, org.Scanner)
+		}
+	}
+	for _, name := range names {
+		if _, err := new_scanner(name, "", *c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type gitleaksScanner struct {
+	Binary         string
+	ConfigPath     string
+	AdditionalArgs []string
+}
+
+func (s *gitleaksScanner) Name() string {
+	return "gitleaks"
+}
+
+// hand written log-opts take precedence over incremental scanning
+func (s *gitleaksScanner) SupportsLogOpts() bool {
+	return !has_log_opts(s.AdditionalArgs)
+}
+
+func (s *gitleaksScanner) Scan(ctx context.Context, req ScanRequest) ([]GitleaksResult, error) {
+	outputpath := filepath.Join(req.WorkDir, "__gitleaks.json")
+	outputarg := fmt.Sprintf("-r=%s", outputpath)
+	confpath := fmt.Sprintf("-c=%s", s.ConfigPath)
+	// not exactly sure why gitleaks doesn't detect that
+	// it IS a git repo, but we can still detect secrets
+	dirarg := fmt.Sprintf("-s=%s", req.Dir)
+	gitleaks_args := []string{"detect", "-v", "-f=json", "--exit-code=0", outputarg, confpath, dirarg}
+	gitleaks_args = append(gitleaks_args, s.AdditionalArgs...)
+	if req.LogOpts != "" {
+		gitleaks_args = append(gitleaks_args, fmt.Sprintf("--log-opts=%s", req.LogOpts))
+	}
+	var outb, errb bytes.Buffer
+	gl_cmd := exec.CommandContext(ctx, s.Binary, gitleaks_args...)
+	kill_on_cancel(gl_cmd)
+	gl_cmd.Stdout = &outb
+	gl_cmd.Stderr = &errb
+	if err := run_cmd(gl_cmd); err != nil {
+		return nil, err
+	}
+	// code useful for debugging, but not for leaving compiled
+	// log.Debug().Str("stdout", outb.String()).Str("stderr", errb.String()).Msg("output from gitleaks")
+
+	// load the result into a GitleaksResult
+	resultfile, err := os.ReadFile(outputpath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening results file: %w", err)
+	}
+	jsonResults := make([]GitleaksResult, 0)
+	if err := json.Unmarshal(resultfile, &jsonResults); err != nil {
+		return nil, fmt.Errorf("error unmarshaling gitleaks results: %w", err)
+	}
+	return jsonResults, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeBinary writes an executable shell script standing in for a scanner
+func fakeBinary(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "fake_scanner")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake scanner: %v", err)
+	}
+	return path
+}
+
+func TestGitleaksScanner(t *testing.T) {
+	workdir := t.TempDir()
+	// the fake gitleaks records its args and writes a report to the -r path
+	binary := fakeBinary(t, `
+for arg in "$@"; do
+  echo "$arg" >> "`+workdir+`/args"
+  case "$arg" in
+    -r=*) report="${arg#-r=}" ;;
+  esac
+done
+cat > "$report" <<'JSON'
+[{"Description":"Generic API Key","StartLine":3,"EndLine":3,"Secret":"s3cr3t","File":"a.txt","Commit":"abc123","RuleID":"generic-api-key"}]
+JSON
+`)
+	s := &gitleaksScanner{Binary: binary, ConfigPath: "gitleaks.toml", AdditionalArgs: []string{"--redact=false"}}
+	findings, err := s.Scan(context.Background(), ScanRequest{Repo: &GitRepo{}, Dir: "/repo", WorkDir: workdir, LogOpts: "--all ^abc"})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(findings) != 1 || findings[0].RuleID != "generic-api-key" || findings[0].Secret != "s3cr3t" {
+		t.Errorf("findings parsed wrong: %+v", findings)
+	}
+	args, _ := os.ReadFile(filepath.Join(workdir, "args"))
+	for _, want := range []string{"detect", "-c=gitleaks.toml", "-s=/repo", "--redact=false", "--log-opts=--all ^abc"} {
+		if !strings.Contains(string(args), want+"\n") {
+			t.Errorf("gitleaks wasn't passed %q, got %s", want, args)
+		}
+	}
+	if (&gitleaksScanner{AdditionalArgs: []string{"--log-opts=--since=1.week"}}).SupportsLogOpts() {
+		t.Errorf("hand written log-opts should disable incremental scans")
+	}
+}
+
+func TestTrufflehogScanner(t *testing.T) {
+	binary := fakeBinary(t, `
+echo '{"level":"info","msg":"not a finding"}' >&2
+echo 'starting scan'
+echo '{"SourceMetadata":{"Data":{"Git":{"commit":"abc123","file":"config.py","email":"Jane Doe <jane@example.com>","timestamp":"2023-01-02 03:04:05 +0000","line":7}}},"DetectorName":"AWS","Verified":true,"Raw":"AKIAEXAMPLE"}'
+`)
+	s := &trufflehogScanner{Binary: binary}
+	findings, err := s.Scan(context.Background(), ScanRequest{Repo: &GitRepo{}, Dir: "/repo", WorkDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("wanted 1 finding, got %d", len(findings))
+	}
+	f := findings[0]
+	if f.RuleID != "trufflehog-aws" || f.File != "config.py" || f.StartLine != 7 || f.Commit != "abc123" {
+		t.Errorf("finding converted wrong: %+v", f)
+	}
+	if f.Author != "Jane Doe" || f.Email != "jane@example.com" || len(f.Tags) != 1 {
+		t.Errorf("author/tags converted wrong: %+v", f)
+	}
+	if f.Date != "2023-01-02T03:04:05Z" {
+		t.Errorf("date should be normalized to RFC3339, got %s", f.Date)
+	}
+}
+
+func TestScannerSelection(t *testing.T) {
+	conf := Conf{Scanner: "trufflehog"}
+	if scanner_name(&GitRepo{}, conf) != "trufflehog" {
+		t.Errorf("global scanner should be used when the org doesn't set one")
+	}
+	if scanner_name(&GitRepo{scanner: "gitleaks"}, conf) != "gitleaks" {
+		t.Errorf("org scanner should override the global one")
+	}
+	if scanner_name(&GitRepo{}, Conf{}) != "gitleaks" {
+		t.Errorf("gitleaks should be the default scanner")
+	}
+	conf.GithubConfig.OrgsToScan = []OrgConfig{{Name: "org", Scanner: "nope"}}
+	if err := conf.validate_scanners(); err == nil {
+		t.Errorf("unknown scanners should fail validation")
+	}
+}
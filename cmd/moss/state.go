@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RepoState is what incremental scanning remembers about a repo between runs
+type RepoState struct {
+	URL string `json:"url"`
+	// Branches maps each ref to the last commit on it that was scanned
+	Branches  map[string]string `json:"branches"`
+	Findings  []GitleaksResult  `json:"findings"`
+	ScannedAt time.Time         `json:"scanned_at"`
+}
+
+// state_path returns the file a repo's state is kept in. Each repo gets its
+// own file so concurrent scans never contend on a shared one.
+func state_path(state_dir string, repo_url string) string {
+	sum := sha256.Sum256([]byte(repo_url))
+	return filepath.Join(state_dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load_repo_state returns the saved state for a repo, or nil if the repo
+// hasn't been scanned before
+func load_repo_state(state_dir string, repo_url string) (*RepoState, error) {
+	contents, err := os.ReadFile(state_path(state_dir, repo_url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state RepoState
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// save writes the state atomically so a crash never leaves a torn file
+func (s *RepoState) save(state_dir string) error {
+	contents, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return write_file_atomic(state_path(state_dir, s.URL), contents)
+}
+
+// write_file_atomic writes to a temp file next to path and renames it over
+// path, creating the directory if needed
+func write_file_atomic(path string, contents []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".state_")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// git_branch_heads returns the commit each branch in the repo at dir points
+// to, covering local branches and the remote tracking branches of a clone
+func git_branch_heads(dir string) (map[string]string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command("git", "-C", dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/remotes")
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	heads := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || strings.HasSuffix(parts[1], "/HEAD") {
+			continue
+		}
+		heads[parts[1]] = parts[0]
+	}
+	return heads, nil
+}
+
+func git_has_commit(dir string, commit string) bool {
+	return exec.Command("git", "-C", dir, "cat-file", "-e", commit+"^{commit}").Run() == nil
+}
+
+// incremental_log_opts builds the gitleaks --log-opts that limit a scan to
+// commits that weren't reachable from any branch at the last scan. It
+// returns "" when a full scan is needed: there's no previous state, or a
+// previously scanned commit is gone because history was rewritten.
+func incremental_log_opts(dir string, state *RepoState) string {
+	if state == nil || len(state.Branches) == 0 {
+		return ""
+	}
+	seen := make(map[string]bool)
+	exclusions := make([]string, 0)
+	for _, commit := range state.Branches {
+		if seen[commit] {
+			continue
+		}
+		seen[commit] = true
+		if !git_has_commit(dir, commit) {
+			return ""
+		}
+		exclusions = append(exclusions, "^"+commit)
+	}
+	sort.Strings(exclusions)
+	return fmt.Sprintf("--all %s", strings.Join(exclusions, " "))
+}
+
+// merge_findings combines previously known findings with the ones from an
+// incremental scan, dropping duplicates
+func merge_findings(previous []GitleaksResult, current []GitleaksResult, repo_url string) []GitleaksResult {
+	merged := make([]GitleaksResult, 0, len(previous)+len(current))
+	seen := make(map[string]bool)
+	for _, findings := range [][]GitleaksResult{previous, current} {
+		for _, finding := range findings {
+			fp := finding.fingerprint(repo_url)
+			if seen[fp] {
+				continue
+			}
+			seen[fp] = true
+			merged = append(merged, finding)
+		}
+	}
+	return merged
+}
+
+// has_log_opts reports whether gitleaks args already limit the commit range
+func has_log_opts(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--log-opts") {
+			return true
+		}
+	}
+	return false
+}
+
+// save_scan_state records the branch heads that were just scanned and all
+// known findings for the repo. Failures only cost the next run a full scan.
+func save_scan_state(state_dir string, repo *GitRepo, scan_dir string, findings []GitleaksResult) {
+	heads, err := git_branch_heads(scan_dir)
+	if err != nil {
+		log.Warn().Err(err).Str("repo", repo.Name).Msg("failed to read branch heads, not saving state")
+		return
+	}
+	state := RepoState{
+		URL:       repo.HTMLURL,
+		Branches:  heads,
+		Findings:  findings,
+		ScannedAt: time.Now().UTC(),
+	}
+	if err := state.save(state_dir); err != nil {
+		log.Warn().Err(err).Str("repo", repo.Name).Msg("failed to save repo state")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepoWithCommit creates a repo with a single commit and returns its path
+func gitRepoWithCommit(t *testing.T) string {
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=moss", "GIT_AUTHOR_EMAIL=moss@example.com",
+			"GIT_COMMITTER_NAME=moss", "GIT_COMMITTER_EMAIL=moss@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v %s", args, err, out)
+		}
+	}
+	run("init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	run("add", "README.md")
+	run("commit", "-q", "-m", "first")
+	return dir
+}
+
+func TestRepoStateRoundTrip(t *testing.T) {
+	state_dir := filepath.Join(t.TempDir(), "state")
+	state, err := load_repo_state(state_dir, "https://github.com/org/repo")
+	if err != nil || state != nil {
+		t.Fatalf("missing state should be nil without an error, got %v %v", state, err)
+	}
+	repo_dir := gitRepoWithCommit(t)
+	repo := &GitRepo{Name: "repo", HTMLURL: "https://github.com/org/repo"}
+	findings := []GitleaksResult{getRepoResult().Results[0]}
+	save_scan_state(state_dir, repo, repo_dir, findings)
+
+	state, err = load_repo_state(state_dir, repo.HTMLURL)
+	if err != nil || state == nil {
+		t.Fatalf("failed to load saved state: %v", err)
+	}
+	if len(state.Findings) != 1 || state.Branches["refs/heads/main"] == "" {
+		t.Errorf("state saved wrong: %+v", state)
+	}
+	log_opts := incremental_log_opts(repo_dir, state)
+	if log_opts != "--all ^"+state.Branches["refs/heads/main"] {
+		t.Errorf("wrong log opts %q", log_opts)
+	}
+	// a commit that no longer exists means history was rewritten
+	state.Branches["refs/heads/gone"] = strings.Repeat("a", 40)
+	if incremental_log_opts(repo_dir, state) != "" {
+		t.Errorf("rewritten history should force a full scan")
+	}
+	if incremental_log_opts(repo_dir, nil) != "" {
+		t.Errorf("no state should force a full scan")
+	}
+}
+
+func TestMergeFindings(t *testing.T) {
+	old := getRepoResult().Results[0]
+	updated := old
+	updated.Commit = "CAFEBABECAFEBABECAFEBABECAFEBABECAFEBABE"
+	merged := merge_findings([]GitleaksResult{old}, []GitleaksResult{old, updated}, "https://github.com/org/repo")
+	if len(merged) != 2 {
+		t.Errorf("wanted 2 merged findings, got %d", len(merged))
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	stream_jsonl_name    = "stream.jsonl"
+	stream_markdown_name = "stream.md"
+)
+
+// stream record types
+const (
+	stream_repo    = "repo"
+	stream_summary = "summary"
+)
+
+// streamRecord is a line of the stream, either a repo result or the run
+// summary written once every repo is done
+type streamRecord struct {
+	Type       string
+	Time       string
+	Org        string           `json:",omitempty"`
+	Repository string           `json:",omitempty"`
+	URL        string           `json:",omitempty"`
+	IsPrivate  bool             `json:",omitempty"`
+	Error      string           `json:",omitempty"`
+	Results    []GitleaksResult `json:",omitempty"`
+	Suppressed []GitleaksResult `json:",omitempty"`
+	Summary    *runSummary      `json:",omitempty"`
+}
+
+// runSummary is the totals of a finished run
+type runSummary struct {
+	Started           string
+	Finished          string
+	Repos             int
+	Errors            int
+	ReposWithFindings int
+	Findings          int
+	Suppressed        int
+	UniqueSecrets     int
+	Outputs           []string
+}
+
+// summarize_run totals up the final results of a run
+func summarize_run(results []GitleaksRepoResult, extras reportExtras, started time.Time, outputs []string) runSummary {
+	summary := runSummary{
+		Started:       started.UTC().Format(time.RFC3339),
+		Finished:      time.Now().UTC().Format(time.RFC3339),
+		Repos:         len(results),
+		UniqueSecrets: len(extras.UniqueSecrets),
+		Outputs:       outputs,
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			summary.Errors = summary.Errors + 1
+		}
+		if len(r.Results) > 0 {
+			summary.ReposWithFindings = summary.ReposWithFindings + 1
+		}
+		summary.Findings = summary.Findings + len(r.Results)
+		summary.Suppressed = summary.Suppressed + len(r.Suppressed)
+	}
+	return summary
+}
+
+// streamSink writes every repo result to the output dir as soon as it's
+// collected, so a run that dies part way still leaves its results behind
+type streamSink struct {
+	conf     Conf
+	jsonl    *os.File
+	markdown *os.File
+}
+
+// open_stream_sink starts the stream files in dir
+func open_stream_sink(dir string, conf Conf) (*streamSink, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND | os.O_TRUNC
+	s := &streamSink{conf: conf}
+	var err error
+	if s.jsonl, err = os.OpenFile(filepath.Join(dir, stream_jsonl_name), flags, 0644); err != nil {
+		return nil, err
+	}
+	if conf.Output.StreamMarkdown {
+		if s.markdown, err = os.OpenFile(filepath.Join(dir, stream_markdown_name), flags, 0644); err != nil {
+			s.jsonl.Close()
+			return nil, err
+		}
+		if err := s.append(s.markdown, []byte("# MOSS Results (in progress)\n")); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// append writes a chunk and syncs it, a record is either there in full or
+// not at all as far as a crash is concerned
+func (s *streamSink) append(f *os.File, contents []byte) error {
+	if _, err := f.Write(contents); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *streamSink) write_record(record streamRecord) error {
+	record.Time = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.append(s.jsonl, append(line, '\n'))
+}
+
+// write streams a filtered repo result the way it'll appear in the reports
+func (s *streamSink) write(result GitleaksRepoResult) {
+	redacted := s.conf.Output.redact_results([]GitleaksRepoResult{result})[0]
+	redacted.applyBaseline(s.conf)
+	record := streamRecord{
+		Type:       stream_repo,
+		Org:        redacted.Org,
+		Repository: redacted.Repository,
+		URL:        redacted.URL,
+		IsPrivate:  redacted.IsPrivate,
+		Results:    redacted.Results,
+		Suppressed: redacted.Suppressed,
+	}
+	if redacted.Err != nil {
+		record.Error = redacted.Err.Error()
+	}
+	if err := s.write_record(record); err != nil {
+		log.Error().Err(err).Str("repo", result.Repository).Msg("failed to stream repo result")
+	}
+	if s.markdown == nil || (len(redacted.Results) == 0 && redacted.Err == nil) {
+		return
+	}
+	section := fmt.Sprintf("### %s/%s\n", redacted.Org, redacted.Repository)
+	if redacted.Err != nil {
+		section = fmt.Sprintf("%sScan failed: %s\n\n", section, record.Error)
+	} else {
+		section = section + markdown_repo_table(redacted)
+	}
+	if err := s.append(s.markdown, []byte(section)); err != nil {
+		log.Error().Err(err).Str("repo", result.Repository).Msg("failed to stream markdown")
+	}
+}
+
+// finish writes the run summary and closes the stream
+func (s *streamSink) finish(summary runSummary) {
+	if err := s.write_record(streamRecord{Type: stream_summary, Summary: &summary}); err != nil {
+		log.Error().Err(err).Msg("failed to stream the run summary")
+	}
+	if s.markdown != nil {
+		totals := fmt.Sprintf("## Summary\n%d repos scanned, %d with findings, %d findings, %d suppressed, %d errors\n",
+			summary.Repos, summary.ReposWithFindings, summary.Findings, summary.Suppressed, summary.Errors)
+		if err := s.append(s.markdown, []byte(totals)); err != nil {
+			log.Error().Err(err).Msg("failed to stream the markdown summary")
+		}
+	}
+	s.close()
+}
+
+func (s *streamSink) close() {
+	if s.markdown != nil {
+		s.markdown.Close()
+	}
+	s.jsonl.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamSink(t *testing.T) {
+	dir := t.TempDir()
+	conf := Conf{}
+	conf.Output.StreamMarkdown = true
+	if err := conf.setup_redaction(redact_full); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := open_stream_sink(dir, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := getRepoResult()
+	failed := GitleaksRepoResult{Repository: "broken", Org: "org", Err: errors.New("clone failed")}
+	sink.write(found)
+	sink.write(failed)
+
+	// the results are on disk before the run finishes
+	contents, err := os.ReadFile(filepath.Join(dir, stream_jsonl_name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(contents), "\n") != 2 || strings.Contains(string(contents), found.Results[0].Secret) {
+		t.Errorf("unexpected stream:\n%s", contents)
+	}
+
+	results := []GitleaksRepoResult{found, failed}
+	sink.finish(summarize_run(results, reportExtras{}, time.Now(), []string{"json"}))
+
+	f, err := os.Open(filepath.Join(dir, stream_jsonl_name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records := make([]streamRecord, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record streamRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 2 repos and a summary, got %d records", len(records))
+	}
+	if records[0].Type != stream_repo || len(records[0].Results) != 1 || records[0].Results[0].Secret != redacted_placeholder {
+		t.Errorf("unexpected repo record %+v", records[0])
+	}
+	if records[1].Error != "clone failed" {
+		t.Errorf("expected the error to be streamed, got %q", records[1].Error)
+	}
+	summary := records[2].Summary
+	if records[2].Type != stream_summary || summary == nil || summary.Repos != 2 || summary.Errors != 1 || summary.Findings != 1 {
+		t.Errorf("unexpected summary %+v", records[2])
+	}
+
+	md, err := os.ReadFile(filepath.Join(dir, stream_markdown_name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"### org/repo", "### org/broken", "Scan failed: clone failed", "## Summary"} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("stream.md is missing %q", want)
+		}
+	}
+}
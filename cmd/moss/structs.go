@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"regexp"
@@ -27,6 +29,31 @@ type GitleaksResult struct {
 	Message     string        `json:"Message"`
 	Tags        []interface{} `json:"Tags"`
 	RuleID      string        `json:"RuleID"`
+	// BaselineState is "new" or "existing" when a baseline is in use
+	BaselineState string `json:"BaselineState,omitempty"`
+	// Suppression is set when the finding was suppressed rather than ignored
+	Suppression *Suppression `json:"Suppression,omitempty"`
+	// SecretHash is the salted sha256 of Secret, the same secret found in
+	// different places has the same hash
+	SecretHash string `json:"SecretHash,omitempty"`
+	// Redaction is the redaction mode applied to Secret and Match
+	Redaction string `json:"Redaction,omitempty"`
+}
+
+// Suppression records why a finding was suppressed. Suppressed findings are
+// left out of the results but still listed in reports.
+type Suppression struct {
+	Kind    string `json:"Kind"`
+	Reason  string `json:"Reason,omitempty"`
+	Expires string `json:"Expires,omitempty"`
+}
+
+// fingerprint identifies a finding across runs: the same secret in the same
+// repo, commit, file, rule and line always hashes to the same value
+func (r GitleaksResult) fingerprint(repo_url string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s:%s:%s:%s:%d", repo_url, r.Commit, r.File, r.RuleID, r.StartLine)
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 type GitRepo struct {
@@ -40,32 +67,96 @@ type GitRepo struct {
 	PushedAt time.Time
 	pat      string
 	provider string
+	// localPath is set for repos that are scanned in place
+	localPath string
+	// scanner overrides the global scanner, set from the org config
+	scanner string
+	// onprem is set for repos on a self hosted server
+	onprem bool
 }
 
 type GitleaksRepoResult struct {
 	Repository string
 	Org        string
 	URL        string
-	Err        error
-	IsPrivate  bool
-	Results    []GitleaksResult
+	// Provider is where the repo is hosted, e.g. GITHUB, for building links
+	Provider string `json:",omitempty"`
+	// Scanner is the scanner the repo was scanned with
+	Scanner   string `json:",omitempty"`
+	Err       error
+	IsPrivate bool
+	Results   []GitleaksResult
+	// Suppressed are findings suppressed by the repo itself, e.g. with an
+	// inline allow comment
+	Suppressed []GitleaksResult `json:",omitempty"`
+	// TimedOut and Canceled are set when the clone or scan didn't finish
+	TimedOut bool `json:",omitempty"`
+	Canceled bool `json:",omitempty"`
+	// CloneAttempts and ScanAttempts count tries, including retries
+	CloneAttempts int `json:",omitempty"`
+	ScanAttempts  int `json:",omitempty"`
 }
 
 type Conf struct {
-	GitlabConfig         ConfGitlabConfig    `yaml:"gitlab_config"`
-	GithubConfig         ConfGithubConfig    `yaml:"github_config"`
-	GitLeaksConfig       GitLeaksConfig      `yaml:"gitleaks_config"`
-	SkipRepos            []string            `yaml:"skip_repos"`
-	IgnoreSecretPatterns []string            `yaml:"ignore_secret_pattern"`
-	IgnoreSecrets        []string            `yaml:"ignore_secrets"`
-	IgnoreCommits        []string            `yaml:"ignore_commits"`
-	ReposToIgnore        map[string][]string `yaml:"repo_ignore"`
-	Output               ConfOutput          `yaml:"output"`
-	MaxConcurrency       int64               `yaml:"max_concurrency"`
+	GitlabConfig      ConfGitlabConfig    `yaml:"gitlab_config"`
+	GithubConfig      ConfGithubConfig    `yaml:"github_config"`
+	BitbucketConfig   ConfBitbucketConfig `yaml:"bitbucket_config"`
+	GiteaConfig       ConfGiteaConfig     `yaml:"gitea_config"`
+	AzureDevOpsConfig ConfAzureConfig     `yaml:"azure_devops_config"`
+	LocalConfig       ConfLocalConfig     `yaml:"local_config"`
+	GitLeaksConfig    GitLeaksConfig      `yaml:"gitleaks_config"`
+	TrufflehogConfig  TrufflehogConfig    `yaml:"trufflehog_config"`
+	Scanner           string              `yaml:"scanner"`
+	SkipRepos         []string            `yaml:"skip_repos"`
+	// the ignore lists hold the values of entries that haven't expired, see
+	// Conf.UnmarshalYAML
+	IgnoreSecretPatterns []string            `yaml:"-"`
+	IgnoreSecrets        []string            `yaml:"-"`
+	IgnoreCommits        []string            `yaml:"-"`
+	ReposToIgnore        map[string][]string `yaml:"-"`
+	// SuppressionRules suppress findings matching a set of conditions
+	SuppressionRules []SuppressionRule `yaml:"suppression_rules"`
+	// IgnoreExpiryWarningDays is how early expiring ignores are warned about
+	IgnoreExpiryWarningDays int             `yaml:"ignore_expiry_warning_days"`
+	Output                  ConfOutput      `yaml:"output"`
+	MaxConcurrency          int64           `yaml:"max_concurrency"`
+	Incremental             ConfIncremental `yaml:"incremental"`
+	CloneCache              ConfCloneCache  `yaml:"clone_cache"`
+	// Baseline is a previous json output whose findings aren't new
+	Baseline string `yaml:"baseline"`
+	// BaselineMode is "suppress" (default) to drop baseline findings or
+	// "mark" to report them as existing
+	BaselineMode string `yaml:"baseline_mode"`
+	// FindingsStore is the json file triage status is kept in
+	FindingsStore string `yaml:"findings_store"`
+	// SecretHashSalt salts secret hashes, MOSS_SECRET_SALT overrides it
+	SecretHashSalt string `yaml:"secret_hash_salt"`
+	// CheckpointDir is where run manifests for -resume are kept, see
+	// checkpoint_base_dir for the default
+	CheckpointDir string `yaml:"checkpoint_dir"`
+	// CloneTimeout and ScanTimeout limit how long a repo's clone and scan
+	// can take, as durations like "30m"
+	CloneTimeout string `yaml:"clone_timeout"`
+	ScanTimeout  string `yaml:"scan_timeout"`
+	// Retry is how transient clone, API and scanner failures are retried
+	Retry ConfRetry `yaml:"retry"`
 	// r_ignore_map is the ignoring of paths in repos
 	r_ignore_map map[string][]*regexp.Regexp
 	// s_ignores is the slice of regular expressions for secrets to ignore
 	s_ignores []*regexp.Regexp
+	// baseline is the set of finding fingerprints in the baseline
+	baseline map[string]bool
+	// findings is the triage store, nil when findings_store isn't set
+	findings *FindingStore
+	// ignore_entries are all ignore entries, including expired ones
+	ignore_entries []configIgnore
+	// suppression_rules are the compiled suppression rules that apply
+	suppression_rules []*suppressionMatcher
+	// secret_salt is the salt in use, random when none is configured
+	secret_salt string
+	// clone_timeout and scan_timeout are the parsed timeouts, 0 for none
+	clone_timeout time.Duration
+	scan_timeout  time.Duration
 }
 type ConfGithubConfig struct {
 	OrgsToScan []OrgConfig `yaml:"orgs_to_scan"`
@@ -75,16 +166,86 @@ type ConfGitlabConfig struct {
 	OrgsToScan []OrgConfig `yaml:"orgs_to_scan"`
 	DaysToScan int         `yaml:"days_to_scan"`
 }
+type ConfBitbucketConfig struct {
+	OrgsToScan []OrgConfig `yaml:"orgs_to_scan"`
+	DaysToScan int         `yaml:"days_to_scan"`
+}
+type ConfGiteaConfig struct {
+	OrgsToScan []OrgConfig `yaml:"orgs_to_scan"`
+	DaysToScan int         `yaml:"days_to_scan"`
+}
+type ConfAzureConfig struct {
+	OrgsToScan []OrgConfig `yaml:"orgs_to_scan"`
+	DaysToScan int         `yaml:"days_to_scan"`
+}
+
+// ConfLocalConfig lists repos that are scanned without a provider API,
+// either already checked out on disk or plain git remotes
+type ConfLocalConfig struct {
+	OrgName string   `yaml:"org_name"`
+	Paths   []string `yaml:"paths"`
+	GitURLs []string `yaml:"git_urls"`
+	Scanner string   `yaml:"scanner"`
+}
 type OrgConfig struct {
 	Name    string `yaml:"name"`
 	Type    string `yaml:"type"`               // "cloud" or "onprem"
 	BaseURL string `yaml:"base_url,omitempty"` // Optional for onprem
+	// GitLab only: full path of the group to scan, defaults to Name
+	Group string `yaml:"group,omitempty"`
+	// GitLab only: scan projects in subgroups, defaults to true
+	IncludeSubgroups *bool `yaml:"include_subgroups,omitempty"`
+	// GitLab only: also scan projects shared with the group
+	IncludeShared bool `yaml:"include_shared,omitempty"`
+	// Scanner overrides the global scanner for this org's repos
+	Scanner string `yaml:"scanner,omitempty"`
+	// Azure DevOps only: REST api version, defaults to 6.0
+	APIVersion string `yaml:"api_version,omitempty"`
 }
 type GitLeaksConfig struct {
 	AdditionalArgs []string `yaml:"additional_args"`
 }
+type TrufflehogConfig struct {
+	AdditionalArgs []string `yaml:"additional_args"`
+}
+type ConfIncremental struct {
+	// StateDir enables incremental scanning when set
+	StateDir string `yaml:"state_dir"`
+}
+type ConfCloneCache struct {
+	// Dir enables keeping mirror clones between runs when set
+	Dir string `yaml:"dir"`
+	// MaxSizeMB caps the cache, least recently used repos are evicted first
+	MaxSizeMB int64 `yaml:"max_size_mb"`
+}
+type ConfRetry struct {
+	Clone RetryPolicy `yaml:"clone"`
+	API   RetryPolicy `yaml:"api"`
+	Scan  RetryPolicy `yaml:"scan"`
+}
+
+// RetryPolicy retries with exponential backoff and jitter, backoffs are
+// durations like "2s"
+type RetryPolicy struct {
+	// MaxAttempts includes the first try, 1 turns retries off
+	MaxAttempts    int    `yaml:"max_attempts"`
+	InitialBackoff string `yaml:"initial_backoff"`
+	MaxBackoff     string `yaml:"max_backoff"`
+	// initial_backoff and max_backoff are the parsed backoffs
+	initial_backoff time.Duration
+	max_backoff     time.Duration
+}
 type ConfOutput struct {
 	Format string `yaml:"format"`
+	// Redaction is how secrets are shown in reports: none, partial, full or
+	// hash. Unset leaves findings as the scanners reported them
+	Redaction string `yaml:"redaction"`
+	// RedactionPrefix is how many characters partial redaction keeps
+	RedactionPrefix int `yaml:"redaction_prefix"`
+	// Stream writes each repo's results to stream.jsonl as they come in
+	Stream bool `yaml:"stream"`
+	// StreamMarkdown also appends them to stream.md
+	StreamMarkdown bool `yaml:"stream_markdown"`
 }
 type RepoScanResult struct {
 	Repository string
@@ -112,16 +273,34 @@ func (c *Conf) getConfig(confPath string) (*Conf, error) {
 		log.Fatal().Err(err).Msg("organization validation failed")
 		return &Conf{}, err
 	}
+	// Validate every configured scanner exists
+	if err := c.validate_scanners(); err != nil {
+		log.Fatal().Err(err).Msg("scanner validation failed")
+		return &Conf{}, err
+	}
+	if err := c.parse_timeouts(); err != nil {
+		log.Fatal().Err(err).Msg("timeout validation failed")
+		return &Conf{}, err
+	}
+	if err := c.parse_retry_policies(); err != nil {
+		log.Fatal().Err(err).Msg("retry policy validation failed")
+		return &Conf{}, err
+	}
 	// build the regex map
 	c.buildIgnoreMap()
 	c.buildSecretIgnores()
+	c.buildSuppressionRules()
+	c.setup_secret_salt()
 	return c, nil
 }
 
 func (c *Conf) validateUniqueOrgNames() error {
-	// Separate maps for GitHub and GitLab organizations
+	// Separate maps for each provider's organizations
 	githubOrgNames := make(map[string]bool)
 	gitlabOrgNames := make(map[string]bool)
+	bitbucketOrgNames := make(map[string]bool)
+	giteaOrgNames := make(map[string]bool)
+	azureOrgNames := make(map[string]bool)
 
 	// Check GitLab org names
 	for _, org := range c.GitlabConfig.OrgsToScan {
@@ -139,6 +318,30 @@ func (c *Conf) validateUniqueOrgNames() error {
 		githubOrgNames[org.Name] = true
 	}
 
+	// Check Bitbucket org names
+	for _, org := range c.BitbucketConfig.OrgsToScan {
+		if _, exists := bitbucketOrgNames[org.Name]; exists {
+			return fmt.Errorf("duplicate Bitbucket organization name found: %s", org.Name)
+		}
+		bitbucketOrgNames[org.Name] = true
+	}
+
+	// Check Gitea org names
+	for _, org := range c.GiteaConfig.OrgsToScan {
+		if _, exists := giteaOrgNames[org.Name]; exists {
+			return fmt.Errorf("duplicate Gitea organization name found: %s", org.Name)
+		}
+		giteaOrgNames[org.Name] = true
+	}
+
+	// Check Azure DevOps org names
+	for _, org := range c.AzureDevOpsConfig.OrgsToScan {
+		if _, exists := azureOrgNames[org.Name]; exists {
+			return fmt.Errorf("duplicate Azure DevOps organization name found: %s", org.Name)
+		}
+		azureOrgNames[org.Name] = true
+	}
+
 	return nil
 }
 
@@ -172,7 +375,7 @@ func (c *Conf) buildSecretIgnores() {
 }
 
 func (c *Conf) setDefaultOrgTypes() {
-	// Set default organization type to "cloud" for GitHub and GitLab if not specified
+	// Set default organization type to "cloud" for all providers if not specified
 	for i, org := range c.GithubConfig.OrgsToScan {
 		if org.Type == "" {
 			c.GithubConfig.OrgsToScan[i].Type = "cloud"
@@ -183,4 +386,19 @@ func (c *Conf) setDefaultOrgTypes() {
 			c.GitlabConfig.OrgsToScan[i].Type = "cloud"
 		}
 	}
+	for i, org := range c.BitbucketConfig.OrgsToScan {
+		if org.Type == "" {
+			c.BitbucketConfig.OrgsToScan[i].Type = "cloud"
+		}
+	}
+	for i, org := range c.GiteaConfig.OrgsToScan {
+		if org.Type == "" {
+			c.GiteaConfig.OrgsToScan[i].Type = "cloud"
+		}
+	}
+	for i, org := range c.AzureDevOpsConfig.OrgsToScan {
+		if org.Type == "" {
+			c.AzureDevOpsConfig.OrgsToScan[i].Type = "cloud"
+		}
+	}
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// kill_wait_delay is how long a killed command gets to close its output
+// before it's abandoned
+const kill_wait_delay = 5 * time.Second
+
+// parse_timeouts reads clone_timeout and scan_timeout, e.g. "30m". Unset
+// timeouts don't limit how long a step can take.
+func (c *Conf) parse_timeouts() error {
+	var err error
+	if c.clone_timeout, err = parse_timeout("clone_timeout", c.CloneTimeout); err != nil {
+		return err
+	}
+	if c.scan_timeout, err = parse_timeout("scan_timeout", c.ScanTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parse_timeout(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s can't be negative", name)
+	}
+	return d, nil
+}
+
+// with_timeout limits ctx to timeout, if there is one
+func with_timeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// interrupted marks the result as timed out or canceled if step_ctx is the
+// reason the step failed
+func (r *GitleaksRepoResult) interrupted(step_ctx context.Context, step string, timeout time.Duration) bool {
+	switch err := step_ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		r.TimedOut = true
+		r.Err = fmt.Errorf("%s timed out after %s", step, timeout)
+	case err != nil:
+		r.Canceled = true
+		r.Err = fmt.Errorf("%s canceled", step)
+	default:
+		return false
+	}
+	return true
+}
+
+// incomplete_markdown lists the repos a run didn't finish scanning
+func incomplete_markdown(results []GitleaksRepoResult, orgs []string) string {
+	json_res := get_json_obj(results, orgs)
+	rows := ""
+	for _, org := range orgs {
+		for _, r := range json_res[org] {
+			if !r.TimedOut && !r.Canceled {
+				continue
+			}
+			rows = fmt.Sprintf("%s|%s/%s|%s|\n", rows, org, r.Repository, r.Err)
+		}
+	}
+	if rows == "" {
+		return ""
+	}
+	return fmt.Sprintf("## Incomplete Scans\nThese repos timed out or were canceled, findings in them may be missing.\n\n|Repository|Reason|\n|----------|------|\n%s\n", rows)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	conf := Conf{CloneTimeout: "10m", ScanTimeout: "1h30m"}
+	if err := conf.parse_timeouts(); err != nil || conf.clone_timeout != 10*time.Minute || conf.scan_timeout != 90*time.Minute {
+		t.Errorf("unexpected timeouts %s %s, %v", conf.clone_timeout, conf.scan_timeout, err)
+	}
+	for _, bad := range []string{"10", "-1m", "soon"} {
+		if err := (&Conf{ScanTimeout: bad}).parse_timeouts(); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestScannerKilledOnTimeout(t *testing.T) {
+	binary := fakeBinary(t, "sleep 10\n")
+	s := &gitleaksScanner{Binary: binary}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := s.Scan(ctx, ScanRequest{Repo: &GitRepo{}, Dir: "/repo", WorkDir: t.TempDir()}); err == nil {
+		t.Error("expected the scan to fail")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the scanner wasn't killed when the context timed out")
+	}
+}
+
+func TestScanRepoInterrupted(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	cwd, _ := os.Getwd()
+	gl_conf := filepath.Join(cwd, "../../configs/gitleaks.toml")
+	repo := &GitRepo{Name: "repo", HTMLURL: "repo", localPath: gitRepoWithCommit(t), orgname: "local"}
+
+	conf := Conf{Scanner: "native", scan_timeout: time.Nanosecond}
+	result := scan_repo_result(context.Background(), repo, gl_conf, conf, semaphore.NewWeighted(1))
+	if !result.TimedOut || result.Canceled || !strings.Contains(result.Err.Error(), "timed out") {
+		t.Errorf("expected the scan to time out, got %+v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = scan_repo_result(ctx, repo, gl_conf, Conf{Scanner: "native"}, semaphore.NewWeighted(1))
+	if !result.Canceled || result.TimedOut {
+		t.Errorf("expected the scan to be canceled, got %+v", result)
+	}
+
+	// temp dirs are cleaned up either way
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("temp dirs were left behind: %v", entries)
+	}
+
+	md := incomplete_markdown([]GitleaksRepoResult{result}, []string{"local"})
+	if !strings.Contains(md, "## Incomplete Scans") || !strings.Contains(md, "|local/repo|scan canceled|") {
+		t.Errorf("unexpected incomplete section:\n%s", md)
+	}
+}
+
+func TestAbortScans(t *testing.T) {
+	cmd := exec.CommandContext(context.Background(), fakeBinary(t, "sleep 30 &\nwait\n"))
+	kill_on_cancel(cmd)
+	if err := start_cmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	temp_dirs.Store(dir, true)
+	defer temp_dirs.Delete(dir)
+
+	start := time.Now()
+	abort_scans()
+	if err := wait_cmd(cmd); err == nil {
+		t.Error("expected the command to be killed")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the command wasn't killed")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("the temp dir wasn't removed")
+	}
+}
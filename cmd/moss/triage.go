@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	triage_open           = "open"
+	triage_false_positive = "false_positive"
+	triage_revoked        = "revoked"
+	triage_accepted_risk  = "accepted_risk"
+)
+
+var triage_statuses = []string{triage_open, triage_false_positive, triage_revoked, triage_accepted_risk}
+
+// triage_suppressed reports whether findings with status are left out of
+// reports. Revoked secrets stay visible since they're still in history.
+func triage_suppressed(status string) bool {
+	return status == triage_false_positive || status == triage_accepted_risk
+}
+
+// TriageEvent is one entry of a finding's audit trail
+type TriageEvent struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+}
+
+// TriageRecord is everything the store knows about one finding
+type TriageRecord struct {
+	Fingerprint string        `json:"fingerprint"`
+	Org         string        `json:"org"`
+	Repository  string        `json:"repository"`
+	URL         string        `json:"url"`
+	RuleID      string        `json:"rule_id"`
+	File        string        `json:"file"`
+	StartLine   int           `json:"start_line"`
+	Commit      string        `json:"commit"`
+	Status      string        `json:"status"`
+	Assignee    string        `json:"assignee,omitempty"`
+	Notes       []string      `json:"notes,omitempty"`
+	FirstSeen   time.Time     `json:"first_seen"`
+	LastSeen    time.Time     `json:"last_seen"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	History     []TriageEvent `json:"history"`
+}
+
+// FindingStore keeps triage records keyed by finding fingerprint in a single
+// json file
+type FindingStore struct {
+	path     string
+	mu       sync.Mutex
+	Findings map[string]*TriageRecord `json:"findings"`
+}
+
+// open_finding_store loads the store at path, a missing file is an empty store
+func open_finding_store(path string) (*FindingStore, error) {
+	store := &FindingStore{path: path, Findings: make(map[string]*TriageRecord)}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, store); err != nil {
+		return nil, fmt.Errorf("failed to read findings store %s: %w", path, err)
+	}
+	if store.Findings == nil {
+		store.Findings = make(map[string]*TriageRecord)
+	}
+	return store, nil
+}
+
+// save writes the store, merging in changes made to the file since it was
+// loaded. A scan keeps the store open for hours while triage changes it, so
+// records triaged in the meantime keep their triage and audit trail and
+// only take the scan's LastSeen. Saves are serialized with a lock file.
+func (s *FindingStore) save() error {
+	unlock, err := lock_file(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock findings store: %w", err)
+	}
+	defer unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	disk, err := open_finding_store(s.path)
+	if err != nil {
+		return err
+	}
+	for fp, theirs := range disk.Findings {
+		ours, ok := s.Findings[fp]
+		switch {
+		case !ok:
+			s.Findings[fp] = theirs
+		case theirs.UpdatedAt.After(ours.UpdatedAt):
+			if ours.LastSeen.After(theirs.LastSeen) {
+				theirs.LastSeen = ours.LastSeen
+			}
+			s.Findings[fp] = theirs
+		case theirs.LastSeen.After(ours.LastSeen):
+			ours.LastSeen = theirs.LastSeen
+		}
+	}
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return write_file_atomic(s.path, contents)
+}
+
+// observe records that a scan reported a finding and returns its record,
+// new findings start out open
+func (s *FindingStore) observe(repo *GitleaksRepoResult, finding GitleaksResult) TriageRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	fp := finding.fingerprint(repo.URL)
+	record, ok := s.Findings[fp]
+	if !ok {
+		record = &TriageRecord{
+			Fingerprint: fp,
+			Org:         repo.Org,
+			Repository:  repo.Repository,
+			URL:         repo.URL,
+			RuleID:      finding.RuleID,
+			File:        finding.File,
+			StartLine:   finding.StartLine,
+			Commit:      finding.Commit,
+			Status:      triage_open,
+			FirstSeen:   now,
+			UpdatedAt:   now,
+			History:     []TriageEvent{{Time: now, Actor: "moss", Action: "detected", To: triage_open}},
+		}
+		s.Findings[fp] = record
+	}
+	record.LastSeen = now
+	return *record
+}
+
+// lookup finds a record by fingerprint or an unambiguous prefix of one
+func (s *FindingStore) lookup(fp string) (*TriageRecord, error) {
+	if record, ok := s.Findings[fp]; ok {
+		return record, nil
+	}
+	var found *TriageRecord
+	for key, record := range s.Findings {
+		if strings.HasPrefix(key, fp) {
+			if found != nil {
+				return nil, fmt.Errorf("fingerprint %s is ambiguous", fp)
+			}
+			found = record
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no finding with fingerprint %s", fp)
+	}
+	return found, nil
+}
+
+// triageUpdate is a change to a record, empty fields are left alone
+type triageUpdate struct {
+	Actor    string
+	Status   string
+	Assignee string
+	Note     string
+}
+
+// update applies a change to a record and appends it to the audit trail
+func (s *FindingStore) update(fp string, u triageUpdate) (TriageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, err := s.lookup(fp)
+	if err != nil {
+		return TriageRecord{}, err
+	}
+	now := time.Now().UTC()
+	event := func(action string, from string, to string) {
+		record.History = append(record.History, TriageEvent{Time: now, Actor: u.Actor, Action: action, From: from, To: to})
+		record.UpdatedAt = now
+	}
+	if u.Status != "" && u.Status != record.Status {
+		if !contains(triage_statuses, u.Status) {
+			return TriageRecord{}, fmt.Errorf("unknown status %q, expected one of %s", u.Status, strings.Join(triage_statuses, ", "))
+		}
+		event("status", record.Status, u.Status)
+		record.Status = u.Status
+	}
+	if u.Assignee != "" && u.Assignee != record.Assignee {
+		event("assignee", record.Assignee, u.Assignee)
+		record.Assignee = u.Assignee
+	}
+	if u.Note != "" {
+		event("note", "", u.Note)
+		record.Notes = append(record.Notes, u.Note)
+	}
+	return *record, nil
+}
+
+// filterTriaged drops findings triaged as false positives or accepted risks
+// and records every other finding in the store
+func (r *GitleaksRepoResult) filterTriaged(store *FindingStore) {
+	if store == nil {
+		return
+	}
+	kept := make([]GitleaksResult, 0)
+	for _, result := range r.Results {
+		record := store.observe(r, result)
+		if triage_suppressed(record.Status) {
+			log.Debug().Str("repo", r.Repository).Str("fingerprint", record.Fingerprint).Str("status", record.Status).Msg("skipping triaged finding")
+			continue
+		}
+		kept = append(kept, result)
+	}
+	r.Results = kept
+}
+
+// setup_findings_store opens the configured store
+func (c *Conf) setup_findings_store() error {
+	if c.FindingsStore == "" {
+		return nil
+	}
+	store, err := open_finding_store(c.FindingsStore)
+	if err != nil {
+		return err
+	}
+	c.findings = store
+	return nil
+}
+
+// config_findings_store reads findings_store from the config without the
+// validation a scan needs, so triage works with just the store
+func config_findings_store(confPath string) string {
+	contents, err := os.ReadFile(confPath)
+	if err != nil {
+		return ""
+	}
+	var conf Conf
+	if err := yaml.Unmarshal(contents, &conf); err != nil {
+		return ""
+	}
+	return conf.FindingsStore
+}
+
+func triage_list(store *FindingStore, status string, out io.Writer) {
+	records := make([]*TriageRecord, 0, len(store.Findings))
+	for _, record := range store.Findings {
+		if status == "" || record.Status == status {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].URL != records[j].URL {
+			return records[i].URL < records[j].URL
+		}
+		return records[i].Fingerprint < records[j].Fingerprint
+	})
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FINGERPRINT\tSTATUS\tASSIGNEE\tREPOSITORY\tFILE\tRULE\tLAST SEEN")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s:%d\t%s\t%s\n", r.Fingerprint[:12], r.Status, r.Assignee,
+			r.Org, r.Repository, r.File, r.StartLine, r.RuleID, r.LastSeen.Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+// run_triage implements `moss triage`, which lists findings in the store or
+// updates the ones given by fingerprint
+func run_triage(args []string, default_store string, out io.Writer) error {
+	flags := flag.NewFlagSet("triage", flag.ContinueOnError)
+	store_path := flags.String("store", default_store, "Findings store, defaults to findings_store from the config")
+	list := flags.Bool("list", false, "List findings in the store")
+	status := flags.String("status", "", "Set the status: "+strings.Join(triage_statuses, ", ")+". With -list, only show findings with this status")
+	assignee := flags.String("assignee", "", "Assign the findings")
+	note := flags.String("note", "", "Add a note to the findings")
+	actor := flags.String("actor", os.Getenv("USER"), "Who is making the change, for the audit trail")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *store_path == "" {
+		return fmt.Errorf("no findings store, set findings_store in the config or pass -store")
+	}
+	store, err := open_finding_store(*store_path)
+	if err != nil {
+		return err
+	}
+	if *list {
+		triage_list(store, *status, out)
+		return nil
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: moss triage [-status=s] [-assignee=a] [-note=n] fingerprint... or moss triage -list")
+	}
+	if *actor == "" {
+		*actor = "unknown"
+	}
+	for _, fp := range flags.Args() {
+		record, err := store.update(fp, triageUpdate{Actor: *actor, Status: *status, Assignee: *assignee, Note: *note})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s %s/%s %s:%d is %s\n", record.Fingerprint[:12], record.Org, record.Repository, record.File, record.StartLine, record.Status)
+	}
+	return store.save()
+}
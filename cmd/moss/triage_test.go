@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTriageLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "findings.json")
+	conf := Conf{FindingsStore: path}
+	if err := conf.setup_findings_store(); err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	first := getRepoResult()
+	first.filterResults(conf)
+	if len(first.Results) != 1 {
+		t.Fatalf("untriaged findings should be reported, got %+v", first.Results)
+	}
+	if err := conf.findings.save(); err != nil {
+		t.Fatalf("failed to save store: %v", err)
+	}
+	fp := first.Results[0].fingerprint(first.URL)
+
+	var out strings.Builder
+	args := []string{"-store=" + path, "-status=false_positive", "-assignee=jane", "-note=test fixture", "-actor=alice", fp[:10]}
+	if err := run_triage(args, "", &out); err != nil {
+		t.Fatalf("triage failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "is false_positive") {
+		t.Errorf("triage should report the new status, got %s", out.String())
+	}
+
+	store, err := open_finding_store(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	record := store.Findings[fp]
+	if record.Status != triage_false_positive || record.Assignee != "jane" || record.Notes[0] != "test fixture" {
+		t.Errorf("record wasn't updated: %+v", record)
+	}
+	// detected, status, assignee and note
+	if len(record.History) != 4 || record.History[1].Actor != "alice" || record.History[1].From != triage_open {
+		t.Errorf("audit trail is wrong: %+v", record.History)
+	}
+
+	second := getRepoResult()
+	second.filterResults(Conf{findings: store})
+	if len(second.Results) != 0 {
+		t.Errorf("false positives should be filtered, got %+v", second.Results)
+	}
+
+	out.Reset()
+	if err := run_triage([]string{"-list", "-status=false_positive"}, path, &out); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), fp[:12]) || !strings.Contains(out.String(), "org/repo") {
+		t.Errorf("list is missing the finding: %s", out.String())
+	}
+	if err := run_triage([]string{"-status=fixed", fp}, path, &out); err == nil {
+		t.Errorf("unknown statuses should fail")
+	}
+	if err := run_triage([]string{fp}, "", &out); err == nil {
+		t.Errorf("triage without a store should fail")
+	}
+}
+
+func TestFindingStoreKeepsConcurrentTriage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "findings.json")
+	conf := Conf{FindingsStore: path}
+	if err := conf.setup_findings_store(); err != nil {
+		t.Fatal(err)
+	}
+	first := getRepoResult()
+	first.filterResults(conf)
+	if err := conf.findings.save(); err != nil {
+		t.Fatal(err)
+	}
+	fp := first.Results[0].fingerprint(first.URL)
+
+	// a long scan loads the store, then the finding is triaged before the
+	// scan saves
+	scan := Conf{FindingsStore: path}
+	if err := scan.setup_findings_store(); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := run_triage([]string{"-store=" + path, "-status=revoked", "-actor=alice", fp}, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	again := getRepoResult()
+	again.filterResults(scan)
+	added := getRepoResult()
+	added.URL = "https://github.com/org/other"
+	added.filterResults(scan)
+	if err := scan.findings.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := open_finding_store(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := store.Findings[fp]
+	if record.Status != triage_revoked || len(record.History) != 2 {
+		t.Errorf("the scan's save lost the triage: %+v", record)
+	}
+	if !record.LastSeen.Equal(scan.findings.Findings[fp].LastSeen) {
+		t.Errorf("the scan's LastSeen wasn't kept: %+v", record)
+	}
+	if len(store.Findings) != 2 {
+		t.Errorf("the scan's new finding wasn't saved, got %d records", len(store.Findings))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// trufflehog_date_layout is how trufflehog formats commit timestamps
+const trufflehog_date_layout = "2006-01-02 15:04:05 -0700"
+
+// parse_finding_date parses a finding's date. Findings carry RFC3339 dates,
+// but trufflehog findings saved by older runs can still use trufflehog's
+// own layout.
+func parse_finding_date(date string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		if t2, err2 := time.Parse(trufflehog_date_layout, date); err2 == nil {
+			return t2, nil
+		}
+	}
+	return t, err
+}
+
+// trufflehogFinding is one line of `trufflehog git --json` output
+type trufflehogFinding struct {
+	SourceMetadata struct {
+		Data struct {
+			Git struct {
+				Commit     string `json:"commit"`
+				File       string `json:"file"`
+				Email      string `json:"email"`
+				Repository string `json:"repository"`
+				Timestamp  string `json:"timestamp"`
+				Line       int    `json:"line"`
+			} `json:"Git"`
+		} `json:"Data"`
+	} `json:"SourceMetadata"`
+	DetectorName string `json:"DetectorName"`
+	Verified     bool   `json:"Verified"`
+	Raw          string `json:"Raw"`
+	RawV2        string `json:"RawV2"`
+}
+
+type trufflehogScanner struct {
+	Binary         string
+	AdditionalArgs []string
+}
+
+func (s *trufflehogScanner) Name() string {
+	return "trufflehog"
+}
+
+// trufflehog can only start from a single commit, not exclude a set of
+// already scanned branch heads, so it always scans the full history
+func (s *trufflehogScanner) SupportsLogOpts() bool {
+	return false
+}
+
+func (s *trufflehogScanner) Scan(ctx context.Context, req ScanRequest) ([]GitleaksResult, error) {
+	args := []string{"git", fmt.Sprintf("file://%s", req.Dir), "--json", "--no-update"}
+	args = append(args, s.AdditionalArgs...)
+	var outb, errb bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Binary, args...)
+	kill_on_cancel(cmd)
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	if err := run_cmd(cmd); err != nil {
+		return nil, err
+	}
+	return parse_trufflehog_output(outb.Bytes())
+}
+
+// parse_trufflehog_output converts trufflehog's JSON lines into findings
+func parse_trufflehog_output(output []byte) ([]GitleaksResult, error) {
+	results := make([]GitleaksResult, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		// trufflehog can mix log lines into stdout, findings are objects
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var finding trufflehogFinding
+		if err := json.Unmarshal(line, &finding); err != nil {
+			return nil, fmt.Errorf("error unmarshaling trufflehog results: %w", err)
+		}
+		results = append(results, trufflehog_to_result(finding))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func trufflehog_to_result(f trufflehogFinding) GitleaksResult {
+	git := f.SourceMetadata.Data.Git
+	author := git.Email
+	email := git.Email
+	// the email field is "Name <address>"
+	if addr, err := mail.ParseAddress(git.Email); err == nil {
+		author = addr.Name
+		email = addr.Address
+	}
+	tags := make([]interface{}, 0)
+	if f.Verified {
+		tags = append(tags, "verified")
+	}
+	// dates are RFC3339 in UTC like gitleaks and the native scanner report
+	date := git.Timestamp
+	if t, err := time.Parse(trufflehog_date_layout, date); err == nil {
+		date = t.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	match := f.Raw
+	if f.RawV2 != "" {
+		match = f.RawV2
+	}
+	return GitleaksResult{
+		Description: f.DetectorName,
+		StartLine:   git.Line,
+		EndLine:     git.Line,
+		Match:       match,
+		Secret:      f.Raw,
+		File:        git.File,
+		Commit:      git.Commit,
+		Author:      author,
+		Email:       email,
+		Date:        date,
+		Tags:        tags,
+		RuleID:      "trufflehog-" + strings.ToLower(f.DetectorName),
+	}
+}
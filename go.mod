@@ -3,6 +3,7 @@ module github.com/livinginsyn/MOSS
 go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/google/go-github/v47 v47.1.0
 	github.com/rs/zerolog v1.34.0
 	github.com/xanzy/go-gitlab v0.115.0